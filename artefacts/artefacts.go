@@ -2,19 +2,28 @@ package artefacts
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"log/slog"
 	"path"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/osfs"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage"
+	"github.com/go-git/go-git/v5/storage/filesystem"
 	"github.com/go-git/go-git/v5/storage/memory"
 )
 
@@ -24,14 +33,49 @@ const (
 	GroupDirectory = "groups"
 )
 
+const (
+	defaultCommitterName  = "softpack-frontend"
+	defaultCommitterEmail = "softpack-frontend@localhost"
+)
+
+// Author identifies the person or service responsible for a change to the
+// artefacts repository.
+type Author struct {
+	Name  string
+	Email string
+}
+
+func (a Author) signature(when time.Time) *object.Signature {
+	return &object.Signature{
+		Name:  a.Name,
+		Email: a.Email,
+		When:  when,
+	}
+}
+
 type Artefacts struct {
-	mu   sync.RWMutex
-	fs   billy.Filesystem
-	repo *git.Repository
-	head *plumbing.Reference
+	mu         sync.RWMutex
+	fs         billy.Filesystem
+	repo       *git.Repository
+	head       *plumbing.Reference
+	committer  Author
+	signKey    *openpgp.Entity
+	keyring    openpgp.EntityList
+	verifyMode VerifyMode
+	unverified []string
+	rejected   bool
+	sparse     bool
+	shallow    bool
+	deleted    deletedCache
+	times      timesCache
+	watchers
 }
 
-var debug = slog.Debug
+var (
+	debug = slog.Debug
+	warn  = slog.Warn
+	now   = time.Now
+)
 
 func New(opts ...Option) (*Artefacts, error) {
 	var o cloneOptions
@@ -40,38 +84,63 @@ func New(opts ...Option) (*Artefacts, error) {
 		opt(&o)
 	}
 
-	var head *plumbing.Reference
+	a := &Artefacts{
+		committer:  o.committer,
+		verifyMode: o.verifyMode,
+	}
+
+	if a.committer.Name == "" {
+		a.committer = Author{Name: defaultCommitterName, Email: defaultCommitterEmail}
+	}
 
-	if o.storage == nil {
-		o.storage = memory.NewStorage()
+	if o.largeObjectThreshold > 0 && o.cacheDir == "" {
+		return nil, ErrLargeObjectsWithoutCache
 	}
 
+	if err := a.loadKeys(&o); err != nil {
+		return nil, err
+	}
+
+	var (
+		head, previous *plumbing.Reference
+		storer         storage.Storer
+	)
+
+	if o.cacheDir != "" {
+		storer = filesystem.NewStorageWithOptions(
+			osfs.New(filepath.Join(o.cacheDir, ".git")),
+			cache.NewObjectLRUDefault(),
+			filesystem.Options{LargeObjectThreshold: o.largeObjectThreshold},
+		)
+	} else {
+		storer = memory.NewStorage()
+	}
+
+	if o.Depth > 0 {
+		o.SingleBranch = true
+	}
+
+	o.NoCheckout = o.sparse
+
 	m := memfs.New()
 
-	r, err := git.Clone(o.storage, m, &o.CloneOptions)
+	r, err := git.Clone(storer, m, &o.CloneOptions)
 	if errors.Is(err, git.ErrRepositoryAlreadyExists) {
 		debug("opening cached artefact repo")
 
-		r, err = git.Open(o.storage, m)
-		if err != nil {
-			return nil, err
-		}
-
-		head, err = r.Head()
+		r, err = git.Open(storer, m)
 		if err != nil {
 			return nil, err
 		}
 
-		w, err := r.Worktree()
+		previous, err = r.Head()
 		if err != nil {
 			return nil, err
 		}
 
 		debug("updating artefact repo")
 
-		if err = w.Pull(&git.PullOptions{
-			Force: true,
-		}); err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		if head, err = fetchHead(r, previous, &o); err != nil {
 			return nil, err
 		}
 	} else if !errors.Is(err, transport.ErrEmptyRemoteRepository) {
@@ -85,19 +154,156 @@ func New(opts ...Option) (*Artefacts, error) {
 		}
 	}
 
-	return &Artefacts{
-		repo: r,
-		fs:   m,
-		head: head,
-	}, nil
+	a.repo = r
+	a.fs = m
+	a.head = head
+	a.sparse = o.sparse
+
+	if shallow, err := r.Storer.Shallow(); err == nil {
+		a.shallow = len(shallow) > 0
+	}
+
+	if err = a.verifyPulled(previous); errors.Is(err, ErrUnverifiedCommit) && previous != nil {
+		warn("rejected pulled artefacts commits", "head", head.Hash(), "err", err)
+
+		a.head = previous
+		a.rejected = true
+	} else if err != nil {
+		return nil, err
+	}
+
+	if a.head != nil && (previous != nil || a.sparse) {
+		if err = a.checkout(a.head.Hash()); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
 }
 
-func (a *Artefacts) getTree(path ...string) (*object.Tree, error) {
+// fetchHead fetches the remote branch tracked by the current head, returning a
+// reference to the fetched commit.
+func fetchHead(r *git.Repository, current *plumbing.Reference, o *cloneOptions) (*plumbing.Reference, error) {
+	if err := r.Fetch(&git.FetchOptions{
+		Auth:  o.Auth,
+		Depth: o.Depth,
+		Force: true,
+	}); err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil, err
+	}
+
+	remote, err := r.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, current.Name().Short()), true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		remote, err = r.Reference(plumbing.NewRemoteHEADReferenceName(git.DefaultRemoteName), true)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return plumbing.NewHashReference(current.Name(), remote.Hash()), nil
+}
+
+// checkout resets the current branch, index and worktree to the given commit.
+//
+// In sparse mode, only the environments directory is written to the worktree,
+// with all other index entries marked as skipped.
+func (a *Artefacts) checkout(hash plumbing.Hash) error {
+	w, err := a.repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	if !a.sparse {
+		return w.Reset(&git.ResetOptions{Commit: hash, Mode: git.HardReset})
+	}
+
+	// go-git treats skipped entries as deleted when diffing against the index,
+	// so the flags must be cleared before resetting.
+	if err = a.clearSkipWorktree(); err != nil {
+		return err
+	}
+
+	if err = w.Reset(&git.ResetOptions{Commit: hash, Mode: git.MixedReset}); err != nil {
+		return err
+	}
+
+	idx, err := a.repo.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range idx.Entries {
+		if entry.SkipWorktree = !strings.HasPrefix(entry.Name, Environments+"/"); entry.SkipWorktree {
+			continue
+		}
+
+		if err = a.checkoutEntry(entry.Name, entry.Hash); err != nil {
+			return err
+		}
+	}
+
+	return a.repo.Storer.SetIndex(idx)
+}
+
+func (a *Artefacts) clearSkipWorktree() error {
+	idx, err := a.repo.Storer.Index()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range idx.Entries {
+		entry.SkipWorktree = false
+	}
+
+	return a.repo.Storer.SetIndex(idx)
+}
+
+func (a *Artefacts) checkoutEntry(name string, hash plumbing.Hash) error {
+	blob, err := a.repo.BlobObject(hash)
+	if err != nil {
+		return err
+	}
+
+	r, err := blob.Reader()
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	f, err := a.fs.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	return f.Close()
+}
+
+func (a *Artefacts) headHash() plumbing.Hash {
 	if a.head == nil {
+		return plumbing.ZeroHash
+	}
+
+	return a.head.Hash()
+}
+
+func (a *Artefacts) getTree(path ...string) (*object.Tree, error) {
+	return a.getTreeAt(a.headHash(), path...)
+}
+
+func (a *Artefacts) getTreeAt(hash plumbing.Hash, path ...string) (*object.Tree, error) {
+	if hash.IsZero() {
 		return &object.Tree{}, nil
 	}
 
-	c, err := a.repo.CommitObject(a.head.Hash())
+	c, err := a.repo.CommitObject(hash)
 	if err != nil {
 		return nil, err
 	}
@@ -153,7 +359,11 @@ func (a *Artefacts) GetEnv(usersOrGroups, userOrGroup, env string) (Environment,
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
-	f, err := a.getTree(usersOrGroups, userOrGroup, env)
+	return a.getEnvAt(a.headHash(), usersOrGroups, userOrGroup, env)
+}
+
+func (a *Artefacts) getEnvAt(hash plumbing.Hash, usersOrGroups, userOrGroup, env string) (Environment, error) {
+	f, err := a.getTreeAt(hash, usersOrGroups, userOrGroup, env)
 	if err != nil {
 		return nil, err
 	}
@@ -169,14 +379,19 @@ func (a *Artefacts) GetEnv(usersOrGroups, userOrGroup, env string) (Environment,
 		files = append(files, f)
 	}
 
-	return a.entriesToEnvironment(path.Join(usersOrGroups, userOrGroup, env), files)
+	return a.entriesToEnvironment(hash, path.Join(usersOrGroups, userOrGroup, env), files)
 }
 
-func (a *Artefacts) entriesToEnvironment(base string, entries []*object.File) (Environment, error) {
+// entriesToEnvironment creates the files of an environment, each reporting
+// the time of the latest change to the environment as its modification time.
+//
+// It must be called with the lock held.
+func (a *Artefacts) entriesToEnvironment(from plumbing.Hash, base string, entries []*object.File) (Environment, error) {
 	e := make(Environment, len(entries))
+	mtime := a.latestChange(from, path.Join(Environments, base))
 
 	for _, entry := range entries {
-		f, err := a.createFileFromEntry(base, entry)
+		f, err := createFileFromEntry(entry, mtime)
 		if err != nil {
 			return nil, err
 		}
@@ -187,25 +402,43 @@ func (a *Artefacts) entriesToEnvironment(base string, entries []*object.File) (E
 	return e, nil
 }
 
-func (a *Artefacts) createFileFromEntry(base string, entry *object.File) (fs.File, error) {
-	r, err := entry.Reader()
+func createFileFromEntry(entry *object.File, mtime time.Time) (*environmentFile, error) {
+	mode, err := entry.Mode.ToOSFileMode()
 	if err != nil {
 		return nil, err
 	}
 
 	return &environmentFile{
-		name: entry.Name,
-		//		mtime:      c.Author.When,
+		name:       path.Base(entry.Name),
 		size:       entry.Size,
-		ReadCloser: r,
+		mode:       mode,
+		mtime:      mtime,
+		ReadCloser: newBlobReader(&entry.Blob),
 	}, nil
 }
 
-func (a *Artefacts) getLatestCommitFromPath(path string) (*object.Commit, error) {
+// latestChange returns the author time of the latest commit to change the given
+// path, or the zero time if it cannot be found.
+//
+// It must be called with the lock held.
+func (a *Artefacts) latestChange(from plumbing.Hash, p string) time.Time {
+	c, err := a.getLatestCommitFromPath(from, p)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return c.Author.When
+}
+
+func (a *Artefacts) getLatestCommitFromPath(from plumbing.Hash, path string) (*object.Commit, error) {
+	dir := path + "/"
+
 	log, err := a.repo.Log(&git.LogOptions{
-		From:     a.head.Hash(),
-		Order:    git.LogOrderCommitterTime,
-		FileName: &path,
+		From:  from,
+		Order: git.LogOrderCommitterTime,
+		PathFilter: func(p string) bool {
+			return p == path || strings.HasPrefix(p, dir)
+		},
 	})
 	if err != nil {
 		return nil, err
@@ -216,25 +449,114 @@ func (a *Artefacts) getLatestCommitFromPath(path string) (*object.Commit, error)
 	return log.Next()
 }
 
-func (a *Artefacts) AddFilesToEnv(usersOrGroups, userOrGroup, env string, files map[string]io.Reader) error {
+// GetFile opens a file of an environment at the current head.
+//
+// The modification time of the file is only looked up in the history when it
+// is first requested, so reading files that don't need it costs no history walk.
+func (a *Artefacts) GetFile(usersOrGroups, userOrGroup, env, name string) (fs.File, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	t, err := a.getTree(usersOrGroups, userOrGroup, env)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := t.File(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ef, err := createFileFromEntry(f, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	head := a.headHash()
+	p := path.Join(Environments, usersOrGroups, userOrGroup, env, name)
+
+	ef.mtimeFn = func() time.Time {
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+
+		return a.latestChange(head, p)
+	}
+
+	return ef, nil
+}
+
+// AddFilesToEnv commits the given files to the environment, recording the
+// given author as responsible for the change.
+//
+// An empty author will attribute the change to the committer.
+func (a *Artefacts) AddFilesToEnv(author Author, usersOrGroups, userOrGroup, env string, files map[string]io.Reader) error {
+	if err := a.addFilesToEnv(author, usersOrGroups, userOrGroup, env, files); err != nil {
+		return err
+	}
+
+	a.notify(path.Join(usersOrGroups, userOrGroup, env))
+
+	return nil
+}
+
+func (a *Artefacts) addFilesToEnv(author Author, usersOrGroups, userOrGroup, env string, files map[string]io.Reader) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	w, err := a.repo.Worktree()
+	w, err := a.writableWorktree()
 	if err != nil {
 		return err
 	}
 
+	action := "Create"
+
+	if _, err = a.getTree(usersOrGroups, userOrGroup, env); err == nil {
+		action = "Update"
+	}
+
+	names := make([]string, 0, len(files))
+
 	for name, file := range files {
 		if err = addFileToWorktree(w, filepath.Join(Environments, usersOrGroups, userOrGroup, env, name), file); err != nil {
 			return err
 		}
+
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return a.commitAndPush(w, author, fmt.Sprintf("%s %s: %s", action, path.Join(usersOrGroups, userOrGroup, env), strings.Join(names, ", ")))
+}
+
+// writableWorktree returns the worktree to which changes can be made, unless
+// commits pulled from the remote were rejected, as pushing on top of the
+// previous head would overwrite them.
+func (a *Artefacts) writableWorktree() (*git.Worktree, error) {
+	if a.rejected {
+		return nil, ErrRejectedHead
+	}
+
+	return a.repo.Worktree()
+}
+
+func (a *Artefacts) commitAndPush(w *git.Worktree, author Author, message string) error {
+	if author.Name == "" {
+		author = a.committer
 	}
 
-	if _, err = w.Commit("Successfully written artefact(s)", &git.CommitOptions{All: true}); err != nil {
+	when := now()
+
+	if _, err := w.Commit(message, &git.CommitOptions{
+		Author:    author.signature(when),
+		Committer: a.committer.signature(when),
+		SignKey:   a.signKey,
+	}); err != nil {
 		return err
 	}
 
+	var err error
+
 	if a.head, err = a.repo.Head(); err != nil {
 		return err
 	}
@@ -258,18 +580,30 @@ func addFileToWorktree(w *git.Worktree, path string, file io.Reader) error {
 		c.Close()
 	}
 
-	if _, err = w.Add(path); err != nil {
+	if err = w.AddWithOptions(&git.AddOptions{Path: path, SkipStatus: true}); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (a *Artefacts) RemoveEnvironment(usersOrGroups, userOrGroup, env string) error {
+// RemoveEnvironment deletes all of the files of the environment, recording the
+// given author as responsible for the change.
+func (a *Artefacts) RemoveEnvironment(author Author, usersOrGroups, userOrGroup, env string) error {
+	if err := a.removeEnvironment(author, usersOrGroups, userOrGroup, env); err != nil {
+		return err
+	}
+
+	a.notify(path.Join(usersOrGroups, userOrGroup, env))
+
+	return nil
+}
+
+func (a *Artefacts) removeEnvironment(author Author, usersOrGroups, userOrGroup, env string) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	w, err := a.repo.Worktree()
+	w, err := a.writableWorktree()
 	if err != nil {
 		return err
 	}
@@ -278,15 +612,10 @@ func (a *Artefacts) RemoveEnvironment(usersOrGroups, userOrGroup, env string) er
 		return err
 	}
 
-	if _, err = w.Commit("Removed environment", &git.CommitOptions{All: true}); err != nil {
-		return err
-	}
-
-	if a.head, err = a.repo.Head(); err != nil {
-		return err
-	}
-
-	return a.repo.Push(&git.PushOptions{
-		Force: true,
-	})
+	return a.commitAndPush(w, author, "Remove "+path.Join(usersOrGroups, userOrGroup, env))
 }
+
+var (
+	ErrLargeObjectsWithoutCache = errors.New("large object threshold requires an FS cache")
+	ErrRejectedHead             = errors.New("remote head was rejected; refusing to overwrite it")
+)
@@ -4,6 +4,7 @@ import (
 	_ "embed"
 	"errors"
 	"io"
+	"io/fs"
 	"log/slog"
 	"slices"
 	"strings"
@@ -85,6 +86,78 @@ func TestGetEnv(t *testing.T) {
 	}
 }
 
+func TestGetFile(t *testing.T) {
+	g := git.New(t)
+	g.Add(t, testFiles)
+
+	r, err := New(Remote(g.URL()))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	c, err := r.repo.CommitObject(r.head.Hash())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	f, err := r.GetFile(UserDirectory, "userA", "env-1", "b-file")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if fi.Name() != "b-file" {
+		t.Errorf("expecting name %q, got %q", "b-file", fi.Name())
+	} else if fi.Size() != 8 {
+		t.Errorf("expecting size 8, got %d", fi.Size())
+	} else if fi.Mode() != 0o644 {
+		t.Errorf("expecting mode %s, got %s", fs.FileMode(0o644), fi.Mode())
+	} else if mt := fi.ModTime(); mt.IsZero() || mt.After(c.Author.When) {
+		t.Errorf("expecting valid modtime, got %s", mt)
+	}
+
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		t.Fatal("expecting file to be seekable")
+	}
+
+	for n, test := range [...]struct {
+		Offset      int64
+		Whence      int
+		Length      int
+		Expectation string
+	}{
+		{Offset: 3, Whence: io.SeekStart, Length: 3, Expectation: "ten"},
+		{Offset: -2, Whence: io.SeekCurrent, Length: 2, Expectation: "en"},
+		{Offset: 0, Whence: io.SeekStart, Length: 4, Expectation: "cont"},
+		{Offset: -2, Whence: io.SeekEnd, Length: 2, Expectation: "ts"},
+	} {
+		buf := make([]byte, test.Length)
+
+		if _, err = rs.Seek(test.Offset, test.Whence); err != nil {
+			t.Errorf("test %d: unexpected error seeking: %s", n+1, err)
+		} else if _, err = io.ReadFull(rs, buf); err != nil {
+			t.Errorf("test %d: unexpected error reading: %s", n+1, err)
+		} else if string(buf) != test.Expectation {
+			t.Errorf("test %d: expecting %q, got %q", n+1, test.Expectation, buf)
+		}
+	}
+
+	if _, err = rs.Seek(-1, io.SeekStart); !errors.Is(err, ErrInvalidSeek) {
+		t.Errorf("expecting error %q, got %q", ErrInvalidSeek, err)
+	}
+
+	f.Close()
+
+	if _, err = r.GetFile(UserDirectory, "userA", "env-1", "c-file"); !errors.Is(err, object.ErrFileNotFound) {
+		t.Errorf("expecting error %q, got %q", object.ErrFileNotFound, err)
+	}
+}
+
 func TestAddFilesToEnv(t *testing.T) {
 	g := git.New(t)
 	g.Add(t, testFiles)
@@ -99,7 +172,7 @@ func TestAddFilesToEnv(t *testing.T) {
 		newFileContents = "BRAND NEW"
 	)
 
-	if err = r.AddFilesToEnv(UserDirectory, "userC", "env-1", map[string]io.Reader{
+	if err = r.AddFilesToEnv(Author{}, UserDirectory, "userC", "env-1", map[string]io.Reader{
 		newFileName: strings.NewReader(newFileContents),
 	}); err != nil {
 		t.Fatalf("unexpected error: %s", err)
@@ -119,6 +192,70 @@ func TestAddFilesToEnv(t *testing.T) {
 	}
 }
 
+func TestCommitAuthorship(t *testing.T) {
+	g := git.New(t)
+	g.Add(t, testFiles)
+
+	committer := Author{Name: "Service", Email: "service@example.com"}
+
+	r, err := New(Remote(g.URL()), Committer(committer.Name, committer.Email))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	user := Author{Name: "userA", Email: "userA@example.com"}
+
+	for n, test := range [...]struct {
+		Change  func() error
+		Author  Author
+		Message string
+	}{
+		{
+			Change: func() error {
+				return r.AddFilesToEnv(user, UserDirectory, "userA", "env-9", map[string]io.Reader{
+					"b-file": strings.NewReader("B"),
+					"a-file": strings.NewReader("A"),
+				})
+			},
+			Author:  user,
+			Message: "Create users/userA/env-9: a-file, b-file",
+		},
+		{
+			Change: func() error {
+				return r.AddFilesToEnv(Author{}, UserDirectory, "userA", "env-9", map[string]io.Reader{
+					"c-file": strings.NewReader("C"),
+				})
+			},
+			Author:  committer,
+			Message: "Update users/userA/env-9: c-file",
+		},
+		{
+			Change: func() error {
+				return r.RemoveEnvironment(user, UserDirectory, "userA", "env-9")
+			},
+			Author:  user,
+			Message: "Remove users/userA/env-9",
+		},
+	} {
+		if err = test.Change(); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		c, err := r.repo.CommitObject(r.head.Hash())
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		if author := (Author{Name: c.Author.Name, Email: c.Author.Email}); author != test.Author {
+			t.Errorf("test %d: expecting author %v, got %v", n+1, test.Author, author)
+		} else if cm := (Author{Name: c.Committer.Name, Email: c.Committer.Email}); cm != committer {
+			t.Errorf("test %d: expecting committer %v, got %v", n+1, committer, cm)
+		} else if c.Message != test.Message {
+			t.Errorf("test %d: expecting message %q, got %q", n+1, test.Message, c.Message)
+		}
+	}
+}
+
 func checkFile(t *testing.T, r *Artefacts, usersOrGroups, userOrGroup, envP, filename, contents string) error {
 	t.Helper()
 
@@ -153,7 +290,7 @@ func TestRemoveEnvironment(t *testing.T) {
 		t.Fatalf("unexpected error: %s", err)
 	}
 
-	if err = r.RemoveEnvironment(UserDirectory, "userA", "env-1"); err != nil {
+	if err = r.RemoveEnvironment(Author{}, UserDirectory, "userA", "env-1"); err != nil {
 		t.Fatalf("unexpected error while removing environment: %s", err)
 	}
 
@@ -190,3 +327,69 @@ func TestCache(t *testing.T) {
 		t.Fatalf("expected to read 2 debug messages, got: %v", messages)
 	}
 }
+
+func TestShallowSparse(t *testing.T) {
+	g := git.New(t)
+	g.Add(t, testFiles)
+	g.Add(t, map[string]string{"README.md": "root file"})
+
+	cache := t.TempDir()
+
+	if _, err := New(Remote(g.URL()), Sparse(), LargeObjectThreshold(1)); !errors.Is(err, ErrLargeObjectsWithoutCache) {
+		t.Errorf("expecting error %q, got %q", ErrLargeObjectsWithoutCache, err)
+	}
+
+	for n, opts := range [...][]Option{
+		{Depth(1), Sparse()},
+		{Depth(2), Sparse(), FS(cache), LargeObjectThreshold(1)},
+		{Depth(2), Sparse(), FS(cache), LargeObjectThreshold(1)},
+	} {
+		r, err := New(append([]Option{Remote(g.URL())}, opts...)...)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		if _, err = r.fs.Stat("README.md"); err == nil {
+			t.Errorf("test %d: expecting README.md not to be checked out", n+1)
+		} else if _, err = r.fs.Stat(Environments + "/users/userA/env-1/a-file"); err != nil {
+			t.Errorf("test %d: expecting environment file to be checked out: %s", n+1, err)
+		}
+
+		if err = checkFile(t, r, GroupDirectory, "groupE", "env-1", "c-file", "CCC"); err != nil {
+			t.Fatalf("test %d: %s", n+1, err)
+		}
+
+		if _, err = r.History(UserDirectory, "userA", "env-1"); err != nil {
+			t.Errorf("test %d: unexpected error reading history: %s", n+1, err)
+		}
+
+		if err = r.AddFilesToEnv(Author{}, UserDirectory, "userA", "env-1", map[string]io.Reader{
+			"d-file": strings.NewReader("DDD"),
+		}); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		if err = r.RemoveEnvironment(Author{}, UserDirectory, "userB", "env-4"); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		full, err := New(Remote(g.URL()))
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		if f, err := full.fs.Open("README.md"); err != nil {
+			t.Errorf("test %d: expecting README.md to be preserved: %s", n+1, err)
+		} else if data, _ := io.ReadAll(f); string(data) != "root file" {
+			t.Errorf("test %d: expecting README.md contents %q, got %q", n+1, "root file", data)
+		}
+
+		if err = checkFile(t, full, UserDirectory, "userA", "env-1", "d-file", "DDD"); err != nil {
+			t.Fatalf("test %d: %s", n+1, err)
+		} else if _, err = full.GetEnv(UserDirectory, "userB", "env-4"); !errors.Is(err, object.ErrDirectoryNotFound) {
+			t.Errorf("test %d: expecting error %q, got %q", n+1, object.ErrDirectoryNotFound, err)
+		}
+
+		g.Add(t, map[string]string{Environments + "/users/userB/env-4/a-file": "4"})
+	}
+}
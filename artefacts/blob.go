@@ -0,0 +1,84 @@
+package artefacts
+
+import (
+	"io"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// blobReader is a seekable reader of a git blob.
+//
+// Blobs can only be read from the start, so seeks are applied on the next
+// Read, skipping forward through the open reader or reopening the blob to move
+// backwards.
+type blobReader struct {
+	blob   *object.Blob
+	r      io.ReadCloser
+	pos    int64
+	offset int64
+}
+
+func newBlobReader(blob *object.Blob) *blobReader {
+	return &blobReader{blob: blob}
+}
+
+func (b *blobReader) Read(p []byte) (int, error) {
+	if err := b.position(); err != nil {
+		return 0, err
+	}
+
+	n, err := b.r.Read(p)
+
+	b.pos += int64(n)
+	b.offset = b.pos
+
+	return n, err
+}
+
+func (b *blobReader) position() error {
+	if b.r != nil && b.pos <= b.offset {
+		_, err := io.CopyN(io.Discard, b.r, b.offset-b.pos)
+		b.pos = b.offset
+
+		return err
+	}
+
+	if b.r != nil {
+		b.r.Close()
+	}
+
+	r, err := b.blob.Reader()
+	if err != nil {
+		return err
+	}
+
+	b.r = r
+	b.pos = 0
+
+	return b.position()
+}
+
+func (b *blobReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += b.offset
+	case io.SeekEnd:
+		offset += b.blob.Size
+	}
+
+	if offset < 0 {
+		return 0, ErrInvalidSeek
+	}
+
+	b.offset = offset
+
+	return offset, nil
+}
+
+func (b *blobReader) Close() error {
+	if b.r == nil {
+		return nil
+	}
+
+	return b.r.Close()
+}
@@ -0,0 +1,280 @@
+package artefacts
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// DeletedEnvironment describes an environment that was removed from the
+// repository and which can be restored from its last revision.
+type DeletedEnvironment struct {
+	Path         string
+	Hash         string
+	Author       string
+	Time         time.Time
+	Message      string
+	LastRevision string
+}
+
+// deletedCache holds the deleted environments as of a particular head, so that
+// a later head only needs the commits made since to be examined.
+type deletedCache struct {
+	mu   sync.Mutex
+	head plumbing.Hash
+	envs []DeletedEnvironment
+}
+
+// Deleted returns up to limit environments, most recently deleted first, that
+// existed in the history of the repository but do not exist at the current
+// head.
+//
+// A limit of zero or less returns all deleted environments.
+func (a *Artefacts) Deleted(limit int) ([]DeletedEnvironment, error) {
+	a.deleted.mu.Lock()
+	defer a.deleted.mu.Unlock()
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if head := a.headHash(); head != a.deleted.head {
+		envs, err := a.deletedSince(head)
+		if err != nil {
+			return nil, err
+		}
+
+		a.deleted.head = head
+		a.deleted.envs = envs
+	}
+
+	envs := a.deleted.envs
+
+	if limit > 0 && limit < len(envs) {
+		envs = envs[:limit]
+	}
+
+	return slices.Clone(envs), nil
+}
+
+// deletedSince walks the history from the given head back to the head of the
+// cached list, merging any newly deleted environments with those still deleted
+// from the cache.
+//
+// If the cached head is not reached the whole history will have been walked,
+// and the cached list is discarded.
+//
+// Must be called with both the cache and artefacts locks held.
+func (a *Artefacts) deletedSince(head plumbing.Hash) ([]DeletedEnvironment, error) {
+	deleted := []DeletedEnvironment{}
+
+	if head.IsZero() {
+		return deleted, nil
+	}
+
+	log, err := a.repo.Log(&git.LogOptions{
+		From:  head,
+		Order: git.LogOrderCommitterTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer log.Close()
+
+	var (
+		seen    = make(map[string]struct{})
+		reached bool
+	)
+
+	if err = log.ForEach(func(c *object.Commit) error {
+		if c.Hash == a.deleted.head {
+			reached = true
+
+			return storer.ErrStop
+		}
+
+		if c.NumParents() == 0 {
+			return nil
+		}
+
+		envs, err := a.removedEnvironments(c)
+		if err != nil {
+			return err
+		}
+
+		for _, env := range envs {
+			if a.deletedAt(head, env, seen) {
+				deleted = append(deleted, DeletedEnvironment{
+					Path:         env,
+					Hash:         c.Hash.String(),
+					Author:       c.Author.Name,
+					Time:         c.Author.When,
+					Message:      c.Message,
+					LastRevision: c.ParentHashes[0].String(),
+				})
+			}
+		}
+
+		return nil
+	}); err != nil && !a.endOfHistory(err) {
+		return nil, err
+	}
+
+	if !reached {
+		return deleted, nil
+	}
+
+	for _, d := range a.deleted.envs {
+		if a.deletedAt(head, d.Path, seen) {
+			deleted = append(deleted, d)
+		}
+	}
+
+	return deleted, nil
+}
+
+// deletedAt reports whether the environment has not already been seen and does
+// not exist at the given head, marking it as seen.
+func (a *Artefacts) deletedAt(head plumbing.Hash, env string, seen map[string]struct{}) bool {
+	if _, ok := seen[env]; ok {
+		return false
+	}
+
+	seen[env] = struct{}{}
+
+	_, err := a.getTreeAt(head, strings.Split(env, "/")...)
+
+	return err != nil
+}
+
+func (a *Artefacts) removedEnvironments(c *object.Commit) ([]string, error) {
+	changes, err := a.diffEnvTrees(c.ParentHashes[0], c.Hash, Environments)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		envs []string
+		last string
+	)
+
+	for _, change := range changes {
+		if change.To.Name != "" {
+			continue
+		}
+
+		parts := strings.SplitN(change.From.Name, "/", 4)
+		if len(parts) < 4 {
+			continue
+		}
+
+		env := path.Join(parts[:3]...)
+
+		if env == last {
+			continue
+		}
+
+		last = env
+
+		if _, err := a.getTreeAt(c.Hash, parts[:3]...); err != nil {
+			envs = append(envs, env)
+		}
+	}
+
+	return envs, nil
+}
+
+// RestoreEnvironment re-commits the files of a deleted environment as they
+// were immediately before it was deleted, recording the given author as
+// responsible for the change.
+func (a *Artefacts) RestoreEnvironment(author Author, usersOrGroups, userOrGroup, env string) error {
+	if err := a.restoreEnvironment(author, usersOrGroups, userOrGroup, env); err != nil {
+		return err
+	}
+
+	a.notify(path.Join(usersOrGroups, userOrGroup, env))
+
+	return nil
+}
+
+func (a *Artefacts) restoreEnvironment(author Author, usersOrGroups, userOrGroup, env string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	head := a.headHash()
+	if head.IsZero() {
+		return ErrNotDeleted
+	}
+
+	if _, err := a.getTreeAt(head, usersOrGroups, userOrGroup, env); err == nil {
+		return ErrEnvironmentExists
+	} else if !errors.Is(err, object.ErrDirectoryNotFound) {
+		return err
+	}
+
+	last, err := a.lastRevision(head, path.Join(Environments, usersOrGroups, userOrGroup, env))
+	if err != nil {
+		return err
+	}
+
+	tree, err := a.getTreeAt(last, usersOrGroups, userOrGroup, env)
+	if err != nil {
+		return err
+	}
+
+	w, err := a.writableWorktree()
+	if err != nil {
+		return err
+	}
+
+	if err = tree.Files().ForEach(func(f *object.File) error {
+		r, err := f.Reader()
+		if err != nil {
+			return err
+		}
+
+		return addFileToWorktree(w, path.Join(Environments, usersOrGroups, userOrGroup, env, f.Name), r)
+	}); err != nil {
+		return err
+	}
+
+	return a.commitAndPush(w, author, fmt.Sprintf("Restore %s from %s", path.Join(usersOrGroups, userOrGroup, env), last.String()[:7]))
+}
+
+func (a *Artefacts) lastRevision(head plumbing.Hash, envPath string) (plumbing.Hash, error) {
+	dir := envPath + "/"
+
+	log, err := a.repo.Log(&git.LogOptions{
+		From:  head,
+		Order: git.LogOrderCommitterTime,
+		PathFilter: func(p string) bool {
+			return strings.HasPrefix(p, dir)
+		},
+	})
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	defer log.Close()
+
+	c, err := log.Next()
+	if err != nil || c.NumParents() == 0 {
+		return plumbing.ZeroHash, ErrNotDeleted
+	}
+
+	return c.ParentHashes[0], nil
+}
+
+var (
+	ErrNotDeleted        = errors.New("environment has not been deleted")
+	ErrEnvironmentExists = errors.New("environment exists")
+)
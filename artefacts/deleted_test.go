@@ -0,0 +1,99 @@
+package artefacts
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/wtsi-hgi/softpack-frontend/internal/git"
+)
+
+func TestRestoreEnvironment(t *testing.T) {
+	g := git.New(t)
+	g.Add(t, testFiles)
+
+	r, err := New(Remote(g.URL()))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, env := range [...][3]string{
+		{UserDirectory, "userA", "env-1"},
+		{GroupDirectory, "groupE", "env-1"},
+		{UserDirectory, "userB", "env-4"},
+	} {
+		if err = r.RemoveEnvironment(Author{}, env[0], env[1], env[2]); err != nil {
+			t.Fatalf("unexpected error removing environment: %s", err)
+		}
+	}
+
+	deleted, err := r.Deleted(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var paths []string
+
+	for _, d := range deleted {
+		paths = append(paths, d.Path)
+	}
+
+	slices.Sort(paths)
+
+	if expectation := []string{"groups/groupE/env-1", "users/userA/env-1", "users/userB/env-4"}; !slices.Equal(paths, expectation) {
+		t.Fatalf("expecting deleted environments %v, got %v", expectation, paths)
+	}
+
+	if deleted, err = r.Deleted(1); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if len(deleted) != 1 {
+		t.Fatalf("expecting 1 deleted environment, got %d", len(deleted))
+	}
+
+	if err = r.RemoveEnvironment(Author{}, UserDirectory, "userB", "env-5"); err != nil {
+		t.Fatalf("unexpected error removing environment: %s", err)
+	}
+
+	if deleted, err = r.Deleted(0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if len(deleted) != 4 || deleted[0].Path != "users/userB/env-5" {
+		t.Errorf("expecting 4 deleted environments, most recently users/userB/env-5, got %v", deleted)
+	}
+
+	if err = r.RestoreEnvironment(Author{}, UserDirectory, "userA", "env-1"); err != nil {
+		t.Fatalf("unexpected error restoring environment: %s", err)
+	}
+
+	if deleted, err = r.Deleted(0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if len(deleted) != 3 || slices.ContainsFunc(deleted, func(d DeletedEnvironment) bool { return d.Path == "users/userA/env-1" }) {
+		t.Errorf("expecting restored environment to no longer be deleted, got %v", deleted)
+	}
+
+	if err = checkFile(t, r, UserDirectory, "userA", "env-1", "b-file", "contents"); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = New(Remote(g.URL()))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err = checkFile(t, r, UserDirectory, "userA", "env-1", "a-file", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if deleted, err = r.Deleted(0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if len(deleted) != 3 {
+		t.Errorf("expecting 3 deleted environments, got %d", len(deleted))
+	}
+
+	if err = r.RestoreEnvironment(Author{}, UserDirectory, "userA", "env-1"); !errors.Is(err, ErrEnvironmentExists) {
+		t.Errorf("expecting error %q, got %q", ErrEnvironmentExists, err)
+	}
+
+	if err = r.RestoreEnvironment(Author{}, UserDirectory, "userA", "env-9"); !errors.Is(err, ErrNotDeleted) {
+		t.Errorf("expecting error %q, got %q", ErrNotDeleted, err)
+	}
+}
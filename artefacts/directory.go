@@ -0,0 +1,237 @@
+package artefacts
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Directory stores artefacts in a plain directory on the local filesystem,
+// without any history.
+//
+// It is laid out the same as the git repository, and returns the same errors,
+// so can be used in its place for small deployments and testing.
+//
+// Only changes made through the Directory are sent to watchers; changes made to
+// the directory by other processes are not noticed.
+type Directory struct {
+	mu   sync.RWMutex
+	root string
+	watchers
+}
+
+// NewDirectory creates a Directory store rooted at the given path, creating the
+// environments directory if it does not exist.
+func NewDirectory(root string) (*Directory, error) {
+	if err := os.MkdirAll(filepath.Join(root, Environments), 0o755); err != nil {
+		return nil, err
+	}
+
+	return &Directory{root: root}, nil
+}
+
+func (d *Directory) path(parts ...string) string {
+	return filepath.Join(append([]string{d.root, Environments}, parts...)...)
+}
+
+// validName reports whether the name can be used as a single component of a
+// path within the directory.
+func validName(name string) bool {
+	return fs.ValidPath(name) && !strings.Contains(name, "/") && name != "."
+}
+
+func validNames(names ...string) bool {
+	for _, name := range names {
+		if !validName(name) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (d *Directory) List(parts ...string) ([]string, error) {
+	if !validNames(parts...) {
+		return nil, object.ErrDirectoryNotFound
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	entries, err := os.ReadDir(d.path(parts...))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, object.ErrDirectoryNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(entries))
+
+	for n, entry := range entries {
+		names[n] = entry.Name()
+	}
+
+	return names, nil
+}
+
+func (d *Directory) GetFile(usersOrGroups, userOrGroup, env, name string) (fs.File, error) {
+	if !validNames(usersOrGroups, userOrGroup, env) {
+		return nil, object.ErrDirectoryNotFound
+	} else if !validName(name) {
+		return nil, object.ErrFileNotFound
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if _, err := os.Stat(d.path(usersOrGroups, userOrGroup, env)); errors.Is(err, fs.ErrNotExist) {
+		return nil, object.ErrDirectoryNotFound
+	}
+
+	f, err := d.openFile(usersOrGroups, userOrGroup, env, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, object.ErrFileNotFound
+	}
+
+	return f, err
+}
+
+func (d *Directory) openFile(usersOrGroups, userOrGroup, env, name string) (fs.File, error) {
+	f, err := os.Open(d.path(usersOrGroups, userOrGroup, env, name))
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+
+		return nil, err
+	}
+
+	return &environmentFile{
+		name:       name,
+		size:       fi.Size(),
+		mode:       fi.Mode(),
+		mtime:      fi.ModTime(),
+		ReadCloser: f,
+	}, nil
+}
+
+// AddFilesToEnv writes the given files to the environment directory,
+// replacing any existing files of the same name.
+//
+// The author is ignored, as the directory keeps no history.
+func (d *Directory) AddFilesToEnv(_ Author, usersOrGroups, userOrGroup, env string, files map[string]io.Reader) error {
+	if err := d.addFilesToEnv(usersOrGroups, userOrGroup, env, files); err != nil {
+		return err
+	}
+
+	d.notify(path.Join(usersOrGroups, userOrGroup, env))
+
+	return nil
+}
+
+func (d *Directory) addFilesToEnv(usersOrGroups, userOrGroup, env string, files map[string]io.Reader) error {
+	if !validNames(usersOrGroups, userOrGroup, env) {
+		return ErrInvalidPath
+	}
+
+	for name := range files {
+		if !validName(name) {
+			return ErrInvalidName
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dir := d.path(usersOrGroups, userOrGroup, env)
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(files))
+
+	for name := range files {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	for _, name := range names {
+		if err := writeFileAtomic(dir, name, files[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeFileAtomic(dir, name string, r io.Reader) error {
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+name+".*")
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(tmp, r); err == nil {
+		err = tmp.Sync()
+	}
+
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(dir, name))
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+
+	return err
+}
+
+// RemoveEnvironment deletes the environment directory.
+//
+// The author is ignored, as the directory keeps no history.
+func (d *Directory) RemoveEnvironment(_ Author, usersOrGroups, userOrGroup, env string) error {
+	if !validNames(usersOrGroups, userOrGroup, env) {
+		return ErrInvalidPath
+	}
+
+	d.mu.Lock()
+	err := os.RemoveAll(d.path(usersOrGroups, userOrGroup, env))
+	d.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	d.notify(path.Join(usersOrGroups, userOrGroup, env))
+
+	return nil
+}
+
+var (
+	ErrInvalidName = errors.New("invalid file name")
+	ErrInvalidPath = errors.New("invalid environment path")
+)
@@ -0,0 +1,156 @@
+package artefacts
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func newTestDirectory(t *testing.T) *Directory {
+	t.Helper()
+
+	root := t.TempDir()
+
+	for name, contents := range testFiles {
+		file := filepath.Join(root, name)
+
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatalf("unexpected error creating directory: %s", err)
+		} else if err = os.WriteFile(file, []byte(contents), 0o644); err != nil {
+			t.Fatalf("unexpected error writing file: %s", err)
+		}
+	}
+
+	d, err := NewDirectory(root)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	return d
+}
+
+func TestDirectoryList(t *testing.T) {
+	d := newTestDirectory(t)
+
+	for n, test := range [...]struct{ Path, Expectation []string }{
+		{Path: []string{UserDirectory}, Expectation: []string{"userA", "userB", "userC"}},
+		{Path: []string{GroupDirectory}, Expectation: []string{"groupD", "groupE"}},
+		{Path: []string{UserDirectory, "userA"}, Expectation: []string{"env-1", "env-2", "env-3"}},
+	} {
+		out, err := d.List(test.Path...)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		} else if !slices.Equal(out, test.Expectation) {
+			t.Errorf("test %d: expecting result %v, got %v", n+1, test.Expectation, out)
+		}
+	}
+
+	if _, err := d.List(UserDirectory, "userZ"); !errors.Is(err, object.ErrDirectoryNotFound) {
+		t.Errorf("expecting error %q, got %q", object.ErrDirectoryNotFound, err)
+	}
+
+	if _, err := d.List(UserDirectory, ".."); !errors.Is(err, object.ErrDirectoryNotFound) {
+		t.Errorf("expecting error %q, got %q", object.ErrDirectoryNotFound, err)
+	}
+}
+
+func TestDirectoryFiles(t *testing.T) {
+	d := newTestDirectory(t)
+
+	changes, stop := d.Watch()
+	defer stop()
+
+	if err := d.AddFilesToEnv(Author{}, UserDirectory, "userC", "env-1", map[string]io.Reader{
+		"newFile": strings.NewReader("BRAND NEW"),
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for name, expectation := range map[string]string{"a-file": "6", "newFile": "BRAND NEW"} {
+		f, err := d.GetFile(UserDirectory, "userC", "env-1", name)
+		if err != nil {
+			t.Errorf("unexpected error opening %s: %s", name, err)
+
+			continue
+		}
+
+		if data, err := io.ReadAll(f); err != nil {
+			t.Errorf("unexpected error reading %s: %s", name, err)
+		} else if string(data) != expectation {
+			t.Errorf("expecting to read %q from %s, got %q", expectation, name, data)
+		}
+
+		f.Close()
+	}
+
+	f, err := d.GetFile(UserDirectory, "userC", "env-1", "newFile")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if fi, err := f.Stat(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if fi.Size() != 9 || fi.Mode() != 0o644 || fi.ModTime().IsZero() {
+		t.Errorf("unexpected file info: size %d, mode %s, modtime %s", fi.Size(), fi.Mode(), fi.ModTime())
+	}
+
+	f.Close()
+
+	if _, err = d.GetFile(UserDirectory, "userC", "env-1", "missing"); !errors.Is(err, object.ErrFileNotFound) {
+		t.Errorf("expecting error %q, got %q", object.ErrFileNotFound, err)
+	}
+
+	if err = d.AddFilesToEnv(Author{}, UserDirectory, "userC", "env-1", map[string]io.Reader{
+		"../escape": strings.NewReader(""),
+	}); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("expecting error %q, got %q", ErrInvalidName, err)
+	}
+
+	for n, path := range [...][3]string{
+		{UserDirectory, "..", "env-1"},
+		{UserDirectory, "userC", "../../.."},
+		{"..", "..", ".."},
+		{UserDirectory, "", "env-1"},
+		{UserDirectory, "userC", "."},
+	} {
+		if err = d.AddFilesToEnv(Author{}, path[0], path[1], path[2], map[string]io.Reader{
+			"a-file": strings.NewReader(""),
+		}); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("test %d: expecting error %q adding files, got %q", n+1, ErrInvalidPath, err)
+		} else if err = d.RemoveEnvironment(Author{}, path[0], path[1], path[2]); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("test %d: expecting error %q removing environment, got %q", n+1, ErrInvalidPath, err)
+		} else if _, err = d.GetFile(path[0], path[1], path[2], "a-file"); !errors.Is(err, object.ErrDirectoryNotFound) {
+			t.Errorf("test %d: expecting error %q getting file, got %q", n+1, object.ErrDirectoryNotFound, err)
+		}
+	}
+
+	if _, err = d.GetFile(UserDirectory, "userC", "env-1", "../../userA/env-1/a-file"); !errors.Is(err, object.ErrFileNotFound) {
+		t.Errorf("expecting error %q, got %q", object.ErrFileNotFound, err)
+	}
+
+	if err = d.RemoveEnvironment(Author{}, UserDirectory, "userC", "env-1"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err = d.GetFile(UserDirectory, "userC", "env-1", "a-file"); !errors.Is(err, object.ErrDirectoryNotFound) {
+		t.Errorf("expecting error %q, got %q", object.ErrDirectoryNotFound, err)
+	}
+
+	for n := range 2 {
+		select {
+		case p := <-changes:
+			if p != "users/userC/env-1" {
+				t.Errorf("test %d: expecting change to users/userC/env-1, got %s", n+1, p)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("test %d: timed out waiting for change", n+1)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package artefacts
 import (
 	"io"
 	"io/fs"
+	"sync"
 	"time"
 )
 
@@ -41,13 +42,23 @@ func (e Environment) Close() error { //nolint:unparam
 }
 
 type environmentFile struct {
-	name  string
-	size  int64
-	mode  fs.FileMode
-	mtime time.Time
+	name      string
+	size      int64
+	mode      fs.FileMode
+	mtime     time.Time
+	mtimeOnce sync.Once
+	mtimeFn   func() time.Time
 	io.ReadCloser
 }
 
+func (e *environmentFile) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := e.ReadCloser.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+
+	return 0, ErrNotSeekable
+}
+
 func (e *environmentFile) Stat() (fs.FileInfo, error) {
 	return e, nil
 }
@@ -65,11 +76,17 @@ func (e *environmentFile) Mode() fs.FileMode {
 }
 
 func (e *environmentFile) ModTime() time.Time {
+	if e.mtimeFn != nil {
+		e.mtimeOnce.Do(func() {
+			e.mtime = e.mtimeFn()
+		})
+	}
+
 	return e.mtime
 }
 
 func (e *environmentFile) IsDir() bool {
-	return false
+	return e.mode.IsDir()
 }
 
 func (e *environmentFile) Sys() any {
@@ -0,0 +1,290 @@
+package artefacts
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// CommitFS is a read-only view of the committed tree of the artefacts
+// repository at a particular commit.
+type CommitFS struct {
+	a    *Artefacts
+	hash plumbing.Hash
+	when time.Time
+	tree *object.Tree
+}
+
+var (
+	_ fs.ReadDirFS = (*CommitFS)(nil)
+	_ fs.StatFS    = (*CommitFS)(nil)
+)
+
+// FS returns a view of the repository at the current head.
+func (a *Artefacts) FS() (*CommitFS, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.head == nil {
+		return &CommitFS{a: a, tree: &object.Tree{}}, nil
+	}
+
+	return a.fsAt(a.head.Hash())
+}
+
+// FSAt returns a view of the repository at the given commit.
+func (a *Artefacts) FSAt(hash plumbing.Hash) (*CommitFS, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.fsAt(hash)
+}
+
+func (a *Artefacts) fsAt(hash plumbing.Hash) (*CommitFS, error) {
+	c, err := a.repo.CommitObject(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	return &CommitFS{
+		a:    a,
+		hash: hash,
+		when: c.Author.When,
+		tree: tree,
+	}, nil
+}
+
+func (f *CommitFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	f.a.mu.RLock()
+	defer f.a.mu.RUnlock()
+
+	if name == "." {
+		return f.dir(name, f.tree), nil
+	}
+
+	entry, err := f.tree.FindEntry(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if entry.Mode == filemode.Dir {
+		tree, err := f.tree.Tree(name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+
+		return f.dir(name, tree), nil
+	}
+
+	file, err := f.tree.TreeEntryFile(entry)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	info, err := f.fileInfo(name, entry, file.Size)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	info.ReadCloser = newBlobReader(&file.Blob)
+
+	return info, nil
+}
+
+func (f *CommitFS) Stat(name string) (fs.FileInfo, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return file.Stat()
+}
+
+func (f *CommitFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	d, ok := file.(*dirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: ErrNotDir}
+	}
+
+	return d.ReadDir(-1)
+}
+
+func (f *CommitFS) fileInfo(name string, entry *object.TreeEntry, size int64) (*environmentFile, error) {
+	mode, err := entry.Mode.ToOSFileMode()
+	if err != nil {
+		return nil, err
+	}
+
+	return &environmentFile{
+		name:    path.Base(name),
+		size:    size,
+		mode:    mode,
+		mtimeFn: f.modTime(name),
+	}, nil
+}
+
+func (f *CommitFS) dir(name string, tree *object.Tree) *dirFile {
+	entries := slices.Clone(tree.Entries)
+
+	slices.SortFunc(entries, func(a, b object.TreeEntry) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return &dirFile{
+		environmentFile: environmentFile{
+			name:    path.Base(name),
+			mode:    fs.ModeDir | 0o755,
+			mtimeFn: f.modTime(name),
+		},
+		fs:      f,
+		path:    name,
+		entries: entries,
+	}
+}
+
+func (f *CommitFS) modTime(name string) func() time.Time {
+	return func() time.Time {
+		if name == "." {
+			return f.when
+		}
+
+		f.a.mu.RLock()
+		defer f.a.mu.RUnlock()
+
+		c, err := f.a.getLatestCommitFromPath(f.hash, name)
+		if err != nil {
+			return time.Time{}
+		}
+
+		return c.Author.When
+	}
+}
+
+type dirFile struct {
+	environmentFile
+	fs      *CommitFS
+	path    string
+	entries []object.TreeEntry
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) {
+	return &d.environmentFile, nil
+}
+
+func (d *dirFile) Read(_ []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: ErrIsDir}
+}
+
+func (d *dirFile) Close() error {
+	return nil
+}
+
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n > 0 && len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	count := len(d.entries)
+	if n > 0 && n < count {
+		count = n
+	}
+
+	entries := make([]fs.DirEntry, count)
+
+	for i, entry := range d.entries[:count] {
+		entries[i] = &dirEntry{
+			fs:    d.fs,
+			path:  path.Join(d.path, entry.Name),
+			entry: entry,
+		}
+	}
+
+	d.entries = d.entries[count:]
+
+	return entries, nil
+}
+
+type dirEntry struct {
+	fs    *CommitFS
+	path  string
+	entry object.TreeEntry
+}
+
+func (d *dirEntry) Name() string {
+	return d.entry.Name
+}
+
+func (d *dirEntry) IsDir() bool {
+	return d.entry.Mode == filemode.Dir
+}
+
+func (d *dirEntry) Type() fs.FileMode {
+	mode, _ := d.entry.Mode.ToOSFileMode() //nolint:errcheck
+
+	return mode.Type()
+}
+
+func (d *dirEntry) Info() (fs.FileInfo, error) {
+	if d.IsDir() {
+		return &environmentFile{
+			name:    d.entry.Name,
+			mode:    fs.ModeDir | 0o755,
+			mtimeFn: d.fs.modTime(d.path),
+		}, nil
+	}
+
+	d.fs.a.mu.RLock()
+	defer d.fs.a.mu.RUnlock()
+
+	var size int64
+
+	if d.entry.Mode != filemode.Submodule {
+		// Only the object header is read to find the size; the contents
+		// are not loaded.
+		obj, err := d.fs.a.repo.Storer.EncodedObject(plumbing.BlobObject, d.entry.Hash)
+		if err != nil {
+			return nil, err
+		}
+
+		size = obj.Size()
+	}
+
+	return d.fs.fileInfo(d.path, &d.entry, size)
+}
+
+func (d *dirEntry) String() string {
+	return fs.FormatDirEntry(d)
+}
+
+var (
+	ErrIsDir       = errors.New("is a directory")
+	ErrNotDir      = errors.New("not a directory")
+	ErrNotSeekable = errors.New("file not seekable")
+	ErrInvalidSeek = errors.New("invalid seek offset")
+)
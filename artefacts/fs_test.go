@@ -0,0 +1,113 @@
+package artefacts
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/wtsi-hgi/softpack-frontend/internal/git"
+)
+
+func TestFS(t *testing.T) {
+	g := git.New(t)
+	g.Add(t, testFiles)
+
+	r, err := New(Remote(g.URL()))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	head, err := r.FS()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := make([]string, 0, len(testFiles))
+
+	for name := range testFiles {
+		expected = append(expected, name)
+	}
+
+	if err = fstest.TestFS(head, expected...); err != nil {
+		t.Fatal(err)
+	}
+
+	var walked []string
+
+	if err = fs.WalkDir(head, Environments+"/"+GroupDirectory, func(path string, d fs.DirEntry, err error) error {
+		if !d.IsDir() {
+			walked = append(walked, path)
+		}
+
+		return err
+	}); err != nil {
+		t.Fatalf("unexpected error walking FS: %s", err)
+	}
+
+	if expectation := []string{
+		"environments/groups/groupD/env-6/a-file",
+		"environments/groups/groupE/env-1/a-file",
+		"environments/groups/groupE/env-1/b-file",
+		"environments/groups/groupE/env-1/c-file",
+	}; !slices.Equal(walked, expectation) {
+		t.Errorf("expecting to walk %v, got %v", expectation, walked)
+	}
+
+	srv := httptest.NewServer(http.FileServerFS(head))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/environments/groups/groupE/env-1/b-file")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	defer resp.Body.Close()
+
+	if body, _ := io.ReadAll(resp.Body); string(body) != "BBB" {
+		t.Errorf("expecting to read %q, got %q", "BBB", body)
+	} else if resp.Header.Get("Last-Modified") == "" {
+		t.Error("expecting Last-Modified header")
+	}
+}
+
+func TestFSAt(t *testing.T) {
+	g := git.New(t)
+	g.Add(t, testFiles)
+
+	r, err := New(Remote(g.URL()))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	old := r.head.Hash()
+
+	if err = r.AddFilesToEnv(Author{}, UserDirectory, "userA", "env-1", map[string]io.Reader{
+		"a-file": strings.NewReader("NEW"),
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for n, test := range [...]struct {
+		FS          func() (*CommitFS, error)
+		Expectation string
+	}{
+		{FS: r.FS, Expectation: "NEW"},
+		{FS: func() (*CommitFS, error) { return r.FSAt(old) }, Expectation: "1"},
+	} {
+		fsys, err := test.FS()
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		if data, err := fs.ReadFile(fsys, Environments+"/"+UserDirectory+"/userA/env-1/a-file"); err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if string(data) != test.Expectation {
+			t.Errorf("test %d: expecting to read %q, got %q", n+1, test.Expectation, data)
+		}
+	}
+}
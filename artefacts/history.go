@@ -0,0 +1,196 @@
+package artefacts
+
+import (
+	"errors"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Revision describes a single commit that changed an environment.
+type Revision struct {
+	Hash    string
+	Author  string
+	Email   string
+	Time    time.Time
+	Message string
+	Files   []string
+}
+
+// History returns the commits that changed the given environment, newest
+// first, along with the names of the environment files each one changed.
+func (a *Artefacts) History(usersOrGroups, userOrGroup, env string) ([]Revision, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	head := a.headHash()
+	if head.IsZero() {
+		return []Revision{}, nil
+	}
+
+	var (
+		envPath   = path.Join(Environments, usersOrGroups, userOrGroup, env)
+		dir       = envPath + "/"
+		revisions = []Revision{}
+	)
+
+	log, err := a.repo.Log(&git.LogOptions{
+		From:  head,
+		Order: git.LogOrderCommitterTime,
+		PathFilter: func(p string) bool {
+			return strings.HasPrefix(p, dir)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer log.Close()
+
+	if err = log.ForEach(func(c *object.Commit) error {
+		files, err := a.changedFiles(c, envPath)
+		if err != nil {
+			return err
+		}
+
+		revisions = append(revisions, Revision{
+			Hash:    c.Hash.String(),
+			Author:  c.Author.Name,
+			Email:   c.Author.Email,
+			Time:    c.Author.When,
+			Message: c.Message,
+			Files:   files,
+		})
+
+		return nil
+	}); err != nil && !a.endOfHistory(err) {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// endOfHistory reports whether the error was caused by walking past the oldest
+// commit of a shallow clone.
+func (a *Artefacts) endOfHistory(err error) bool {
+	return a.shallow && errors.Is(err, plumbing.ErrObjectNotFound)
+}
+
+func (a *Artefacts) changedFiles(c *object.Commit, envPath string) ([]string, error) {
+	var from plumbing.Hash
+
+	if c.NumParents() > 0 {
+		from = c.ParentHashes[0]
+	}
+
+	changes, err := a.diffEnvTrees(from, c.Hash, envPath)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(changes))
+
+	for _, change := range changes {
+		files = append(files, changeName(change))
+	}
+
+	slices.Sort(files)
+
+	return files, nil
+}
+
+func changeName(change *object.Change) string {
+	if change.To.Name != "" {
+		return change.To.Name
+	}
+
+	return change.From.Name
+}
+
+func (a *Artefacts) diffEnvTrees(from, to plumbing.Hash, envPath string) (object.Changes, error) {
+	fromTree, err := a.envTreeAt(from, envPath)
+	if err != nil {
+		return nil, err
+	}
+
+	toTree, err := a.envTreeAt(to, envPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return object.DiffTree(fromTree, toTree)
+}
+
+func (a *Artefacts) envTreeAt(hash plumbing.Hash, envPath string) (*object.Tree, error) {
+	if hash.IsZero() {
+		return nil, nil
+	}
+
+	c, err := a.repo.CommitObject(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err = tree.Tree(envPath)
+	if errors.Is(err, object.ErrDirectoryNotFound) {
+		return nil, nil
+	}
+
+	return tree, err
+}
+
+// GetEnvAt acts like GetEnv, but reads the environment as it was at the given
+// commit.
+func (a *Artefacts) GetEnvAt(hash plumbing.Hash, usersOrGroups, userOrGroup, env string) (Environment, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if hash.IsZero() {
+		return nil, plumbing.ErrObjectNotFound
+	}
+
+	return a.getEnvAt(hash, usersOrGroups, userOrGroup, env)
+}
+
+// DiffFile returns a unified diff of the named environment file between the
+// two given commits.
+//
+// A zero hash for to will compare against the current head.
+func (a *Artefacts) DiffFile(from, to plumbing.Hash, usersOrGroups, userOrGroup, env, name string) (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if from.IsZero() {
+		return "", plumbing.ErrObjectNotFound
+	}
+
+	if to.IsZero() {
+		to = a.headHash()
+	}
+
+	changes, err := a.diffEnvTrees(from, to, path.Join(Environments, usersOrGroups, userOrGroup, env))
+	if err != nil {
+		return "", err
+	}
+
+	changes = slices.DeleteFunc(changes, func(change *object.Change) bool {
+		return changeName(change) != name
+	})
+
+	patch, err := changes.Patch()
+	if err != nil {
+		return "", err
+	}
+
+	return patch.String(), nil
+}
@@ -0,0 +1,89 @@
+package artefacts
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/wtsi-hgi/softpack-frontend/internal/git"
+)
+
+func TestHistory(t *testing.T) {
+	g := git.New(t)
+	g.Add(t, testFiles)
+
+	r, err := New(Remote(g.URL()))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	initial := r.head.Hash()
+
+	if err = r.AddFilesToEnv(Author{}, UserDirectory, "userA", "env-1", map[string]io.Reader{
+		"a-file": strings.NewReader("1\n2\n"),
+		"c-file": strings.NewReader("new"),
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err = r.AddFilesToEnv(Author{}, UserDirectory, "userB", "env-4", map[string]io.Reader{
+		"a-file": strings.NewReader("other"),
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	revisions, err := r.History(UserDirectory, "userA", "env-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if len(revisions) != 3 {
+		t.Fatalf("expecting 3 revisions, got %d", len(revisions))
+	}
+
+	var initialFiles []string
+
+	for n, rev := range revisions {
+		if rev.Author == "" || rev.Time.IsZero() {
+			t.Errorf("test %d: expecting author and time, got %q and %s", n+1, rev.Author, rev.Time)
+		} else if n > 0 {
+			initialFiles = append(initialFiles, rev.Files...)
+		}
+	}
+
+	slices.Sort(initialFiles)
+
+	if files := revisions[0].Files; !slices.Equal(files, []string{"a-file", "c-file"}) {
+		t.Errorf("expecting latest revision to change files [a-file c-file], got %v", files)
+	} else if !slices.Equal(initialFiles, []string{"a-file", "b-file"}) {
+		t.Errorf("expecting initial revisions to change files [a-file b-file], got %v", initialFiles)
+	}
+
+	env, err := r.GetEnvAt(initial, UserDirectory, "userA", "env-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if _, ok := env["c-file"]; ok {
+		t.Error("expecting c-file not to exist in initial revision")
+	} else if data, _ := io.ReadAll(env["a-file"]); string(data) != "1" {
+		t.Errorf("expecting to read %q, got %q", "1", data)
+	}
+
+	diff, err := r.DiffFile(initial, plumbing.ZeroHash, UserDirectory, "userA", "env-1", "a-file")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if !strings.Contains(diff, "-1\n") || !strings.Contains(diff, "+2\n") {
+		t.Errorf("expecting diff of a-file, got %q", diff)
+	} else if strings.Contains(diff, "c-file") {
+		t.Errorf("expecting diff to only contain a-file, got %q", diff)
+	}
+
+	if _, err = r.GetEnvAt(plumbing.NewHash("0123456789abcdef0123456789abcdef01234567"), UserDirectory, "userA", "env-1"); !errors.Is(err, plumbing.ErrObjectNotFound) {
+		t.Errorf("expecting error %q, got %q", plumbing.ErrObjectNotFound, err)
+	}
+
+	if _, err = r.GetEnvAt(initial, UserDirectory, "userA", "env-9"); !errors.Is(err, object.ErrDirectoryNotFound) {
+		t.Errorf("expecting error %q, got %q", object.ErrDirectoryNotFound, err)
+	}
+}
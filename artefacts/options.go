@@ -1,23 +1,22 @@
 package artefacts
 
 import (
-	"path/filepath"
-
-	"github.com/go-git/go-billy/v5"
-	"github.com/go-git/go-billy/v5/osfs"
 	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing/cache"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
-	"github.com/go-git/go-git/v5/storage"
-	"github.com/go-git/go-git/v5/storage/filesystem"
 )
 
 type Option func(*cloneOptions)
 
 type cloneOptions struct {
 	git.CloneOptions
-	fs      billy.Filesystem
-	storage storage.Storer
+	cacheDir             string
+	largeObjectThreshold int64
+	sparse               bool
+	committer            Author
+
+	signingKey, passphrase string
+	verifyKeyring          string
+	verifyMode             VerifyMode
 }
 
 func Remote(url string) Option {
@@ -45,7 +44,69 @@ func Token(token string) Option {
 
 func FS(path string) Option {
 	return func(o *cloneOptions) {
-		o.fs = osfs.New(path)
-		o.storage = filesystem.NewStorage(osfs.New(filepath.Join(path, ".git")), cache.NewObjectLRUDefault())
+		o.cacheDir = path
+	}
+}
+
+// LargeObjectThreshold sets the size, in bytes, above which objects in an FS
+// cache will be streamed from disk when read, instead of being loaded into
+// memory.
+//
+// Without an FS cache all objects are held in memory, so setting a threshold
+// without one is an error.
+func LargeObjectThreshold(size int64) Option {
+	return func(o *cloneOptions) {
+		o.largeObjectThreshold = size
+	}
+}
+
+// Depth limits the history fetched from the remote to the given number of
+// commits from the tip of the branch.
+//
+// History, mod times and deleted environments will only reflect the fetched
+// commits.
+func Depth(depth int) Option {
+	return func(o *cloneOptions) {
+		o.Depth = depth
+	}
+}
+
+// Sparse only checks out the environments directory into the in-memory
+// worktree, leaving any other files in the repository untouched.
+//
+// This only reduces the size of the worktree; the fetched objects are still
+// held in memory unless an FS cache is used.
+func Sparse() Option {
+	return func(o *cloneOptions) {
+		o.sparse = true
+	}
+}
+
+// Committer sets the identity recorded as the committer of all changes made to
+// the artefacts repository, and as the author of changes that have no acting
+// user.
+func Committer(name, email string) Option {
+	return func(o *cloneOptions) {
+		o.committer = Author{Name: name, Email: email}
+	}
+}
+
+// SigningKey signs every commit made to the artefacts repository with the first
+// private key in the given OpenPGP keyring file, which may be armored, and
+// which will be decrypted with the given passphrase if necessary.
+func SigningKey(path, passphrase string) Option {
+	return func(o *cloneOptions) {
+		o.signingKey = path
+		o.passphrase = passphrase
+	}
+}
+
+// VerifyCommits checks the signatures of commits pulled from the remote
+// against the public keys in the given OpenPGP keyring file, handling commits
+// that cannot be verified according to the given mode.
+func VerifyCommits(keyring string, mode VerifyMode) Option {
+	return func(o *cloneOptions) {
+		o.verifyKeyring = keyring
+		o.verifyMode = mode
 	}
 }
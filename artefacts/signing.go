@@ -0,0 +1,183 @@
+package artefacts
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// VerifyMode determines how commits pulled from the remote that cannot be
+// verified are handled.
+type VerifyMode uint8
+
+const (
+	// FlagUnverified logs a warning for each unverified commit and records it
+	// so that it can be retrieved with Unverified.
+	FlagUnverified VerifyMode = iota
+
+	// RejectUnverified refuses to move to a pulled head when any of the
+	// commits since the previous head cannot be verified, leaving a cached
+	// repository at its previous commit, to which no changes can then be made
+	// as pushing them would overwrite the rejected commits. A fresh clone with
+	// any unverifiable commit fails to load.
+	RejectUnverified
+)
+
+func (a *Artefacts) loadKeys(o *cloneOptions) error {
+	if o.signingKey != "" {
+		key, err := loadSigningKey(o.signingKey, o.passphrase)
+		if err != nil {
+			return fmt.Errorf("error loading signing key: %w", err)
+		}
+
+		a.signKey = key
+	}
+
+	if o.verifyKeyring != "" {
+		keyring, err := readKeyRing(o.verifyKeyring)
+		if err != nil {
+			return fmt.Errorf("error loading verification keyring: %w", err)
+		}
+
+		a.keyring = keyring
+	}
+
+	return nil
+}
+
+func readKeyRing(path string) (openpgp.EntityList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data)); err == nil {
+		return keyring, nil
+	}
+
+	return openpgp.ReadKeyRing(bytes.NewReader(data))
+}
+
+func loadSigningKey(path, passphrase string) (*openpgp.Entity, error) {
+	keyring, err := readKeyRing(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entity := range keyring {
+		if entity.PrivateKey == nil {
+			continue
+		}
+
+		if entity.PrivateKey.Encrypted {
+			if err := entity.DecryptPrivateKeys([]byte(passphrase)); err != nil {
+				return nil, err
+			}
+		}
+
+		return entity, nil
+	}
+
+	return nil, ErrNoSigningKey
+}
+
+func (a *Artefacts) verifyPulled(previous *plumbing.Reference) error {
+	if a.keyring == nil || a.head == nil {
+		return nil
+	}
+
+	var from plumbing.Hash
+
+	if previous != nil {
+		from = previous.Hash()
+	}
+
+	return a.verifyCommits(from, a.head.Hash())
+}
+
+// verifyCommits checks the signatures of every commit reachable from to that
+// is not reachable through from. When from is zero, the whole history of to is
+// checked.
+func (a *Artefacts) verifyCommits(from, to plumbing.Hash) error {
+	if from == to {
+		return nil
+	}
+
+	c, err := a.repo.CommitObject(to)
+	if err != nil {
+		return err
+	}
+
+	var ignore []plumbing.Hash
+
+	if !from.IsZero() {
+		ignore = append(ignore, from)
+	}
+
+	iter := object.NewCommitPreorderIter(c, nil, ignore)
+
+	defer iter.Close()
+
+	err = iter.ForEach(func(c *object.Commit) error {
+		if err := a.verifyCommit(c); err != nil {
+			a.unverified = append(a.unverified, c.Hash.String())
+
+			if a.verifyMode == RejectUnverified {
+				return fmt.Errorf("%w: %s: %w", ErrUnverifiedCommit, c.Hash, err)
+			}
+
+			warn("unverified artefacts commit", "commit", c.Hash, "err", err)
+		}
+
+		return nil
+	})
+	if a.endOfHistory(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (a *Artefacts) verifyCommit(c *object.Commit) error {
+	if c.PGPSignature == "" {
+		return ErrUnsignedCommit
+	}
+
+	var encoded plumbing.MemoryObject
+
+	if err := c.EncodeWithoutSignature(&encoded); err != nil {
+		return err
+	}
+
+	r, err := encoded.Reader()
+	if err != nil {
+		return err
+	}
+
+	_, err = openpgp.CheckArmoredDetachedSignature(a.keyring, r, strings.NewReader(c.PGPSignature), nil)
+
+	return err
+}
+
+// Unverified returns the hashes of the commits pulled from the remote whose
+// signatures could not be verified, including any that caused a pull to be
+// rejected.
+func (a *Artefacts) Unverified() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return slices.Clone(a.unverified)
+}
+
+var (
+	ErrNoSigningKey     = errors.New("no private key in keyring")
+	ErrUnsignedCommit   = errors.New("commit is not signed")
+	ErrUnverifiedCommit = errors.New("unverified commit")
+)
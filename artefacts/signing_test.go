@@ -0,0 +1,178 @@
+package artefacts
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/wtsi-hgi/softpack-frontend/internal/git"
+)
+
+func writeTestKeys(t *testing.T, passphrase string) (string, string) {
+	t.Helper()
+
+	entity, err := openpgp.NewEntity("Service", "", "service@example.com", nil)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %s", err)
+	}
+
+	dir := t.TempDir()
+	private := filepath.Join(dir, "private.asc")
+	public := filepath.Join(dir, "public.asc")
+
+	for _, key := range [...]struct {
+		Path      string
+		BlockType string
+		Write     func(io.Writer) error
+	}{
+		{
+			Path:      private,
+			BlockType: openpgp.PrivateKeyType,
+			Write: func(w io.Writer) error {
+				if err := entity.EncryptPrivateKeys([]byte(passphrase), nil); err != nil {
+					return err
+				}
+
+				return entity.SerializePrivateWithoutSigning(w, nil)
+			},
+		},
+		{Path: public, BlockType: openpgp.PublicKeyType, Write: entity.Serialize},
+	} {
+		f, err := os.Create(key.Path)
+		if err != nil {
+			t.Fatalf("unexpected error creating key file: %s", err)
+		}
+
+		w, err := armor.Encode(f, key.BlockType, nil)
+		if err != nil {
+			t.Fatalf("unexpected error encoding key: %s", err)
+		} else if err = key.Write(w); err != nil {
+			t.Fatalf("unexpected error writing key: %s", err)
+		} else if err = w.Close(); err != nil {
+			t.Fatalf("unexpected error closing key encoder: %s", err)
+		} else if err = f.Close(); err != nil {
+			t.Fatalf("unexpected error closing key file: %s", err)
+		}
+	}
+
+	return private, public
+}
+
+func TestSigning(t *testing.T) {
+	g := git.New(t)
+	g.Add(t, testFiles)
+
+	private, public := writeTestKeys(t, "passphrase")
+
+	if _, err := New(Remote(g.URL()), SigningKey(private, "wrong")); err == nil {
+		t.Fatal("expecting error decrypting key with wrong passphrase")
+	} else if _, err = New(Remote(g.URL()), SigningKey(public, "")); !errors.Is(err, ErrNoSigningKey) {
+		t.Fatalf("expecting error %q, got %q", ErrNoSigningKey, err)
+	}
+
+	r, err := New(Remote(g.URL()), SigningKey(private, "passphrase"), VerifyCommits(public, FlagUnverified))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if unverified := r.Unverified(); len(unverified) != len(testFiles) || unverified[0] != r.head.Hash().String() {
+		t.Errorf("expecting every unsigned commit to be flagged, got %v", unverified)
+	}
+
+	if _, err = New(Remote(g.URL()), VerifyCommits(public, RejectUnverified)); !errors.Is(err, ErrUnverifiedCommit) {
+		t.Errorf("expecting error %q, got %q", ErrUnverifiedCommit, err)
+	}
+
+	if err = r.AddFilesToEnv(Author{}, UserDirectory, "userA", "env-1", map[string]io.Reader{
+		"a-file": strings.NewReader("signed"),
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	c, err := r.repo.CommitObject(r.head.Hash())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if err = r.verifyCommit(c); err != nil {
+		t.Errorf("unexpected error verifying signed commit: %s", err)
+	}
+
+	if _, err = New(Remote(g.URL()), VerifyCommits(public, RejectUnverified)); !errors.Is(err, ErrUnverifiedCommit) {
+		t.Errorf("expecting unsigned history behind signed head to give error %q, got %q", ErrUnverifiedCommit, err)
+	}
+
+	g = git.New(t)
+
+	if r, err = New(Remote(g.URL()), SigningKey(private, "passphrase")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, contents := range [...]string{"first", "second"} {
+		if err = r.AddFilesToEnv(Author{}, UserDirectory, "userA", "env-1", map[string]io.Reader{
+			"a-file": strings.NewReader(contents),
+		}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	if _, err = New(Remote(g.URL()), VerifyCommits(public, RejectUnverified)); err != nil {
+		t.Errorf("unexpected error loading signed history: %s", err)
+	}
+}
+
+func TestVerifyPulled(t *testing.T) {
+	g := git.New(t)
+	g.Add(t, testFiles)
+
+	private, public := writeTestKeys(t, "")
+	cache := t.TempDir()
+
+	r, err := New(Remote(g.URL()), FS(cache), SigningKey(private, ""))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	signed := r.head.Hash()
+
+	g.Add(t, map[string]string{Environments + "/users/userA/env-1/a-file": "unsigned"})
+
+	if r, err = New(Remote(g.URL()), FS(cache), VerifyCommits(public, RejectUnverified)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if r.head.Hash() != signed {
+		t.Errorf("expecting unverified pull to be rejected, staying at %s, got %s", signed, r.head.Hash())
+	} else if err = checkFile(t, r, UserDirectory, "userA", "env-1", "a-file", "1"); err != nil {
+		t.Error(err)
+	} else if unverified := r.Unverified(); len(unverified) != 1 || unverified[0] == signed.String() {
+		t.Errorf("expecting the rejected commit to be reported, got %v", unverified)
+	}
+
+	if err = r.AddFilesToEnv(Author{}, UserDirectory, "userA", "env-1", map[string]io.Reader{
+		"a-file": strings.NewReader("overwrite"),
+	}); !errors.Is(err, ErrRejectedHead) {
+		t.Errorf("expecting error %q, got %q", ErrRejectedHead, err)
+	} else if err = r.RemoveEnvironment(Author{}, UserDirectory, "userA", "env-1"); !errors.Is(err, ErrRejectedHead) {
+		t.Errorf("expecting error %q, got %q", ErrRejectedHead, err)
+	}
+
+	if r, err = New(Remote(g.URL()), SigningKey(private, "")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if err = r.AddFilesToEnv(Author{}, UserDirectory, "userA", "env-2", map[string]io.Reader{
+		"a-file": strings.NewReader("signed"),
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if r, err = New(Remote(g.URL()), FS(cache), VerifyCommits(public, RejectUnverified)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if r.head.Hash() != signed {
+		t.Errorf("expecting unsigned commit behind signed head to be rejected, staying at %s, got %s", signed, r.head.Hash())
+	}
+
+	if r, err = New(Remote(g.URL()), FS(cache), VerifyCommits(public, FlagUnverified)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if unverified := r.Unverified(); len(unverified) != 1 || unverified[0] == signed.String() {
+		t.Errorf("expecting only the pulled commit to be flagged, got %v", unverified)
+	}
+}
@@ -0,0 +1,199 @@
+package artefacts
+
+import (
+	"maps"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// Times records when an environment was created and when it was last changed.
+type Times struct {
+	Created time.Time
+	Updated time.Time
+}
+
+// timesCache holds the environment times as of a particular head, so that a
+// later head only needs the commits made since to be examined.
+type timesCache struct {
+	mu    sync.Mutex
+	head  plumbing.Hash
+	times map[string]Times
+}
+
+// EnvironmentTimes returns the creation and last update times of environments
+// that exist at the current head, keyed by their path relative to the
+// environments directory.
+//
+// If paths are given, only those environments will be returned.
+//
+// An environment that was removed and later recreated is considered to have
+// been created when it was recreated.
+func (a *Artefacts) EnvironmentTimes(paths ...string) (map[string]Times, error) {
+	a.times.mu.Lock()
+	defer a.times.mu.Unlock()
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if head := a.headHash(); head != a.times.head || a.times.times == nil {
+		times, err := a.timesSince(head)
+		if err != nil {
+			return nil, err
+		}
+
+		a.times.head = head
+		a.times.times = times
+	}
+
+	if len(paths) == 0 {
+		return maps.Clone(a.times.times), nil
+	}
+
+	times := make(map[string]Times, len(paths))
+
+	for _, p := range paths {
+		if t, ok := a.times.times[p]; ok {
+			times[p] = t
+		}
+	}
+
+	return times, nil
+}
+
+// timesSince walks the history from the given head back to the head of the
+// cached times, merging the times of environments changed since with those in
+// the cache.
+//
+// If the cached head is not reached the whole history will have been walked,
+// and the cached times are discarded.
+//
+// Must be called with both the cache and artefacts locks held.
+func (a *Artefacts) timesSince(head plumbing.Hash) (map[string]Times, error) {
+	times := make(map[string]Times)
+
+	if head.IsZero() {
+		return times, nil
+	}
+
+	log, err := a.repo.Log(&git.LogOptions{
+		From:  head,
+		Order: git.LogOrderCommitterTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer log.Close()
+
+	var (
+		done    = make(map[string]bool)
+		reached bool
+	)
+
+	if err = log.ForEach(func(c *object.Commit) error {
+		if c.Hash == a.times.head {
+			reached = true
+
+			return storer.ErrStop
+		}
+
+		var parent plumbing.Hash
+
+		if c.NumParents() > 0 {
+			parent = c.ParentHashes[0]
+
+			if _, err := a.repo.CommitObject(parent); a.endOfHistory(err) {
+				parent = plumbing.ZeroHash
+			} else if err != nil {
+				return err
+			}
+		}
+
+		envs, err := a.changedEnvironments(parent, c.Hash)
+		if err != nil {
+			return err
+		}
+
+		for _, env := range envs {
+			if done[env] {
+				continue
+			}
+
+			t, ok := times[env]
+			if !ok {
+				if _, err := a.getTreeAt(head, strings.Split(env, "/")...); err != nil {
+					done[env] = true
+
+					continue
+				}
+
+				t.Updated = c.Author.When
+			}
+
+			t.Created = c.Author.When
+			times[env] = t
+
+			if _, err := a.getTreeAt(parent, strings.Split(env, "/")...); err != nil || parent.IsZero() {
+				done[env] = true
+			}
+		}
+
+		return nil
+	}); err != nil && !a.endOfHistory(err) {
+		return nil, err
+	}
+
+	if !reached {
+		return times, nil
+	}
+
+	for env, cached := range a.times.times {
+		if done[env] {
+			continue
+		} else if t, ok := times[env]; ok {
+			t.Created = cached.Created
+			times[env] = t
+		} else {
+			times[env] = cached
+		}
+	}
+
+	return times, nil
+}
+
+func (a *Artefacts) changedEnvironments(from, to plumbing.Hash) ([]string, error) {
+	changes, err := a.diffEnvTrees(from, to, Environments)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		envs []string
+		last string
+	)
+
+	for _, change := range changes {
+		parts := strings.SplitN(changeName(change), "/", 4)
+		if len(parts) < 4 {
+			continue
+		}
+
+		env := path.Join(parts[:3]...)
+
+		if env == last {
+			continue
+		}
+
+		last = env
+		envs = append(envs, env)
+	}
+
+	return envs, nil
+}
@@ -0,0 +1,116 @@
+package artefacts
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wtsi-hgi/softpack-frontend/internal/git"
+)
+
+func TestEnvironmentTimes(t *testing.T) {
+	g := git.New(t)
+	g.Add(t, map[string]string{"README.md": "readme"})
+
+	r, err := New(Remote(g.URL()))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	base := time.Now().Add(time.Hour).Truncate(time.Second)
+	step := 0
+
+	defer func() { now = time.Now }()
+
+	now = func() time.Time {
+		return base.Add(time.Duration(step) * time.Minute)
+	}
+
+	add := func(owner, env string) {
+		step++
+
+		if err := r.AddFilesToEnv(Author{}, UserDirectory, owner, env, map[string]io.Reader{
+			"file": strings.NewReader(strconv.Itoa(step)),
+		}); err != nil {
+			t.Fatalf("unexpected error adding files: %s", err)
+		}
+	}
+
+	add("userA", "envA")
+	add("userA", "envA")
+	add("userB", "envB")
+
+	step++
+
+	if err = r.RemoveEnvironment(Author{}, UserDirectory, "userA", "envA"); err != nil {
+		t.Fatalf("unexpected error removing environment: %s", err)
+	}
+
+	add("userA", "envA")
+	add("userB", "envB")
+	add("userC", "envC")
+
+	step++
+
+	if err = r.RemoveEnvironment(Author{}, UserDirectory, "userC", "envC"); err != nil {
+		t.Fatalf("unexpected error removing environment: %s", err)
+	}
+
+	at := func(n int) time.Time {
+		return base.Add(time.Duration(n) * time.Minute)
+	}
+
+	times, err := r.EnvironmentTimes()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if len(times) != 2 {
+		t.Fatalf("expecting times for 2 environments, got %v", times)
+	}
+
+	for n, test := range [...]struct {
+		Path             string
+		Created, Updated time.Time
+	}{
+		{Path: "users/userA/envA", Created: at(5), Updated: at(5)},
+		{Path: "users/userB/envB", Created: at(3), Updated: at(6)},
+	} {
+		if got := times[test.Path]; !got.Created.Equal(test.Created) || !got.Updated.Equal(test.Updated) {
+			t.Errorf("test %d: expecting times %v, got %v", n+1, test, got)
+		}
+	}
+
+	if times, err = r.EnvironmentTimes("users/userB/envB"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if got := times["users/userB/envB"]; len(times) != 1 || !got.Created.Equal(at(3)) || !got.Updated.Equal(at(6)) {
+		t.Errorf("expecting times for only users/userB/envB, got %v", times)
+	}
+
+	add("userB", "envB")
+	add("userD", "envD")
+
+	step++
+
+	if err = r.RemoveEnvironment(Author{}, UserDirectory, "userA", "envA"); err != nil {
+		t.Fatalf("unexpected error removing environment: %s", err)
+	}
+
+	if times, err = r.EnvironmentTimes(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if len(times) != 2 {
+		t.Fatalf("expecting times for 2 environments, got %v", times)
+	}
+
+	for n, test := range [...]struct {
+		Path             string
+		Created, Updated time.Time
+	}{
+		{Path: "users/userB/envB", Created: at(3), Updated: at(9)},
+		{Path: "users/userD/envD", Created: at(10), Updated: at(10)},
+	} {
+		if got := times[test.Path]; !got.Created.Equal(test.Created) || !got.Updated.Equal(test.Updated) {
+			t.Errorf("test %d: expecting updated times %v, got %v", n+1, test, got)
+		}
+	}
+}
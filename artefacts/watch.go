@@ -0,0 +1,54 @@
+package artefacts
+
+import "sync"
+
+const watchBuffer = 16
+
+type watchers struct {
+	mu    sync.Mutex
+	chans map[chan string]struct{}
+}
+
+// Watch returns a channel that will receive the path, relative to the
+// environments directory, of each environment that is changed, along with a
+// function to stop watching.
+//
+// Changes will be dropped for watchers that fall too far behind.
+func (w *watchers) Watch() (<-chan string, func()) {
+	ch := make(chan string, watchBuffer)
+
+	w.mu.Lock()
+
+	if w.chans == nil {
+		w.chans = make(map[chan string]struct{})
+	}
+
+	w.chans[ch] = struct{}{}
+
+	w.mu.Unlock()
+
+	var once sync.Once
+
+	return ch, func() {
+		once.Do(func() {
+			w.mu.Lock()
+			delete(w.chans, ch)
+			w.mu.Unlock()
+
+			close(ch)
+		})
+	}
+}
+
+func (w *watchers) notify(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for ch := range w.chans {
+		select {
+		case ch <- path:
+		default:
+			warn("dropped artefact change notification", "env", path)
+		}
+	}
+}
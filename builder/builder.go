@@ -0,0 +1,133 @@
+// Package builder submits environments to a build service and reports on the
+// progress of their builds.
+package builder
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/wtsi-hgi/softpack-frontend/artefacts"
+	"gopkg.in/yaml.v3"
+)
+
+// State is the stage a build has reached.
+type State uint8
+
+const (
+	Queued State = iota
+	Building
+	Failed
+	Ready
+)
+
+var stateNames = [...]string{ //nolint:gochecknoglobals
+	Queued:   "queued",
+	Building: "building",
+	Failed:   "failed",
+	Ready:    "ready",
+}
+
+func (s State) String() string {
+	if int(s) < len(stateNames) {
+		return stateNames[s]
+	}
+
+	return "unknown"
+}
+
+func (s State) MarshalText() ([]byte, error) {
+	if int(s) >= len(stateNames) {
+		return nil, ErrUnknownState
+	}
+
+	return []byte(stateNames[s]), nil
+}
+
+func (s *State) UnmarshalText(text []byte) error {
+	pos := slices.Index(stateNames[:], string(text))
+	if pos < 0 {
+		return ErrUnknownState
+	}
+
+	*s = State(pos)
+
+	return nil
+}
+
+// Build describes an environment to be built.
+type Build struct {
+	// Path is the location of the environment relative to the environments
+	// directory, e.g. users/someone/env-1.
+	Path         string
+	SoftpackYML  []byte
+	SpackVersion string
+}
+
+// Status describes the progress of a build.
+type Status struct {
+	Path      string
+	State     State
+	Requested time.Time
+	Started   time.Time
+	Finished  time.Time
+	Error     string `json:",omitempty"`
+}
+
+// Builder submits builds and reports on their progress.
+//
+// Callers poll Status to follow a build until it is Failed or Ready.
+type Builder interface {
+	Submit(ctx context.Context, build Build) error
+	Status(ctx context.Context, path string) (Status, error)
+}
+
+type softpackYML struct {
+	Description string
+	Packages    []string
+}
+
+func (b *Build) parse() (softpackYML, error) {
+	var spec softpackYML
+
+	if _, _, _, err := splitPath(b.Path); err != nil {
+		return spec, err
+	}
+
+	if err := yaml.Unmarshal(b.SoftpackYML, &spec); err != nil {
+		return spec, err
+	}
+
+	if len(spec.Packages) == 0 {
+		return spec, ErrNoPackages
+	}
+
+	return spec, nil
+}
+
+func splitPath(p string) (string, string, string, error) {
+	parts := strings.Split(p, "/")
+	if len(parts) != 3 || slices.Contains(parts, "") ||
+		parts[0] != artefacts.UserDirectory && parts[0] != artefacts.GroupDirectory {
+		return "", "", "", ErrInvalidPath
+	}
+
+	return parts[0], parts[1], parts[2], nil
+}
+
+var (
+	ErrUnknownState = errors.New("unknown build state")
+	ErrUnknownBuild = errors.New("unknown build")
+	ErrInvalidPath  = errors.New("invalid environment path")
+	ErrNoPackages   = errors.New("no packages to build")
+	ErrBadResponse  = errors.New("bad response from build service")
+
+	ErrAlreadyBuilding = errors.New("environment is already being built")
+)
+
+var (
+	_ Builder = (*HTTP)(nil)
+	_ Builder = (*Fake)(nil)
+)
@@ -0,0 +1,151 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wtsi-hgi/softpack-frontend/artefacts"
+	"github.com/wtsi-hgi/softpack-frontend/module"
+)
+
+const fakeModuleBase = "HGI/softpack"
+
+// Store is the part of the artefact store that the Fake builder writes its
+// results to.
+type Store interface {
+	AddFilesToEnv(author artefacts.Author, usersOrGroups, userOrGroup, env string, files map[string]io.Reader) error
+}
+
+// Fake is a local Builder for testing that, after a delay, writes the
+// artefacts of a build directly to a store.
+//
+// Builds of a softpack.yml that cannot be parsed, or that has no packages, will
+// fail, writing only a builder.out.
+type Fake struct {
+	store Store
+	delay time.Duration
+
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	builds map[string]Status
+}
+
+// NewFake creates a Fake builder that writes to the given store after the
+// given delay.
+func NewFake(store Store, delay time.Duration) *Fake {
+	return &Fake{
+		store:  store,
+		delay:  delay,
+		builds: make(map[string]Status),
+	}
+}
+
+func (f *Fake) Submit(_ context.Context, build Build) error {
+	if _, _, _, err := splitPath(build.Path); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if status, ok := f.builds[build.Path]; ok && (status.State == Queued || status.State == Building) {
+		return ErrAlreadyBuilding
+	}
+
+	f.builds[build.Path] = Status{
+		Path:      build.Path,
+		State:     Queued,
+		Requested: time.Now(),
+	}
+
+	f.wg.Add(1)
+
+	go f.run(build)
+
+	return nil
+}
+
+func (f *Fake) run(build Build) {
+	defer f.wg.Done()
+
+	f.update(build.Path, func(s *Status) {
+		s.State = Building
+		s.Started = time.Now()
+	})
+
+	time.Sleep(f.delay)
+
+	files, buildErr := f.artefacts(build)
+
+	usersOrGroups, owner, name, _ := splitPath(build.Path)
+
+	if err := f.store.AddFilesToEnv(artefacts.Author{}, usersOrGroups, owner, name, files); err != nil && buildErr == nil {
+		buildErr = err
+	}
+
+	f.update(build.Path, func(s *Status) {
+		s.Finished = time.Now()
+
+		if buildErr != nil {
+			s.State = Failed
+			s.Error = buildErr.Error()
+		} else {
+			s.State = Ready
+		}
+	})
+}
+
+func (f *Fake) artefacts(build Build) (map[string]io.Reader, error) {
+	spec, err := build.parse()
+	if err != nil {
+		return map[string]io.Reader{
+			"builder.out": strings.NewReader(fmt.Sprintf("build failed: %s\n", err)),
+		}, err
+	}
+
+	modulePath := path.Join(fakeModuleBase, build.Path)
+
+	return map[string]io.Reader{
+		"module":      strings.NewReader(fakeModule(build.Path, spec)),
+		"README.md":   module.GenerateEnvReadme(modulePath),
+		"builder.out": strings.NewReader(fmt.Sprintf("built %s with spack %s\n", build.Path, build.SpackVersion)),
+	}, nil
+}
+
+func fakeModule(envPath string, spec softpackYML) string {
+	return fmt.Sprintf("#%%Module\n\nmodule-whatis \"Name: %s\"\nmodule-whatis \"Packages: %s\"\n",
+		path.Base(envPath), strings.Join(spec.Packages, ", "))
+}
+
+func (f *Fake) update(p string, fn func(*Status)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	status := f.builds[p]
+
+	fn(&status)
+
+	f.builds[p] = status
+}
+
+func (f *Fake) Status(_ context.Context, path string) (Status, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	status, ok := f.builds[path]
+	if !ok {
+		return status, ErrUnknownBuild
+	}
+
+	return status, nil
+}
+
+// Wait blocks until all submitted builds have finished.
+func (f *Fake) Wait() {
+	f.wg.Wait()
+}
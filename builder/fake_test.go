@@ -0,0 +1,104 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wtsi-hgi/softpack-frontend/artefacts"
+)
+
+func TestFake(t *testing.T) {
+	store, err := artefacts.NewDirectory(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	f := NewFake(store, 10*time.Millisecond)
+	ctx := context.Background()
+
+	if _, err = f.Status(ctx, "users/userA/envA-1"); !errors.Is(err, ErrUnknownBuild) {
+		t.Fatalf("expecting error %q, got %q", ErrUnknownBuild, err)
+	}
+
+	for n, test := range [...]struct {
+		Build Build
+		Err   error
+	}{
+		{Build: Build{Path: "users/userA/envA-1", SoftpackYML: []byte("packages:\n - packageA\n"), SpackVersion: "0.21"}},
+		{Build: Build{Path: "users/userA/envA-1", SoftpackYML: []byte("packages:\n - packageA\n")}, Err: ErrAlreadyBuilding},
+		{Build: Build{Path: "groups/groupB/envB-1", SoftpackYML: []byte("description: B\n")}},
+		{Build: Build{Path: "users/userA"}, Err: ErrInvalidPath},
+	} {
+		if err = f.Submit(ctx, test.Build); !errors.Is(err, test.Err) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Err, err)
+		}
+	}
+
+	if status, err := f.Status(ctx, "users/userA/envA-1"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if status.State != Queued && status.State != Building {
+		t.Errorf("expecting build to be in progress, got %s", status.State)
+	}
+
+	f.Wait()
+
+	for n, test := range [...]struct {
+		Path  string
+		State State
+		Files map[string]string
+	}{
+		{
+			Path:  "users/userA/envA-1",
+			State: Ready,
+			Files: map[string]string{
+				"module":      "Packages: packageA",
+				"README.md":   "module load HGI/softpack/users/userA/envA-1",
+				"builder.out": "spack 0.21",
+			},
+		},
+		{
+			Path:  "groups/groupB/envB-1",
+			State: Failed,
+			Files: map[string]string{
+				"builder.out": ErrNoPackages.Error(),
+			},
+		},
+	} {
+		status, err := f.Status(ctx, test.Path)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		} else if status.State != test.State {
+			t.Errorf("test %d: expecting state %s, got %s", n+1, test.State, status.State)
+		} else if status.Finished.Before(status.Started) || status.Started.Before(status.Requested) {
+			t.Errorf("test %d: expecting ordered build times, got %v", n+1, status)
+		}
+
+		parts := strings.Split(test.Path, "/")
+
+		names, err := store.List(parts...)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		} else if len(names) != len(test.Files) {
+			t.Errorf("test %d: expecting %d files, got %d", n+1, len(test.Files), len(names))
+		}
+
+		for name, contains := range test.Files {
+			f, err := store.GetFile(parts[0], parts[1], parts[2], name)
+			if err != nil {
+				t.Errorf("test %d: expecting file %s, got error: %s", n+1, name, err)
+
+				continue
+			}
+
+			if data, _ := io.ReadAll(f); !strings.Contains(string(data), contains) {
+				t.Errorf("test %d: expecting %s to contain %q, got %q", n+1, name, contains, data)
+			}
+
+			f.Close()
+		}
+	}
+}
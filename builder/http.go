@@ -0,0 +1,109 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	submitEndpoint = "/environments/build"
+	statusEndpoint = "/environments/status"
+)
+
+// HTTP submits builds to a remote build service.
+type HTTP struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTP creates a Builder that talks to the build service at the given base
+// URL.
+//
+// A nil client will use http.DefaultClient.
+func NewHTTP(baseURL string, client *http.Client) *HTTP {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &HTTP{url: strings.TrimSuffix(baseURL, "/"), client: client}
+}
+
+type buildRequest struct {
+	Path         string
+	SpackVersion string
+	Description  string
+	Packages     []string
+}
+
+func (h *HTTP) Submit(ctx context.Context, build Build) error {
+	spec, err := build.parse()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(buildRequest{
+		Path:         build.Path,
+		SpackVersion: build.SpackVersion,
+		Description:  spec.Description,
+		Packages:     spec.Packages,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url+submitEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	return checkResponse(resp)
+}
+
+func (h *HTTP) Status(ctx context.Context, path string) (Status, error) {
+	var status Status
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url+statusEndpoint+"?"+url.Values{"path": {path}}.Encode(), nil)
+	if err != nil {
+		return status, err
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return status, err
+	}
+
+	defer resp.Body.Close()
+
+	if err = checkResponse(resp); err != nil {
+		return status, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&status)
+
+	return status, err
+}
+
+func checkResponse(resp *http.Response) error {
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrUnknownBuild
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return fmt.Errorf("%w: %s", ErrBadResponse, resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package builder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTP(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []buildRequest
+		started  = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	)
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST "+submitEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		var req buildRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		mu.Lock()
+		received = append(received, req)
+		mu.Unlock()
+	})
+	mux.HandleFunc("GET "+statusEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		switch p := r.URL.Query().Get("path"); p {
+		case "users/userA/envA-1":
+			json.NewEncoder(w).Encode(Status{Path: p, State: Building, Started: started}) //nolint:errcheck
+		case "users/userA/broken":
+			http.Error(w, "oops", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	b := NewHTTP(s.URL+"/", nil)
+	ctx := context.Background()
+
+	for n, test := range [...]struct {
+		Build Build
+		Err   error
+	}{
+		{
+			Build: Build{
+				Path:         "users/userA/envA-1",
+				SoftpackYML:  []byte("description: A\npackages:\n - packageA@1\n - packageB\n"),
+				SpackVersion: "0.21",
+			},
+		},
+		{Build: Build{Path: "users/userA", SoftpackYML: []byte("packages:\n - packageA\n")}, Err: ErrInvalidPath},
+		{Build: Build{Path: "others/userA/env", SoftpackYML: []byte("packages:\n - packageA\n")}, Err: ErrInvalidPath},
+		{Build: Build{Path: "users/userA/env", SoftpackYML: []byte("description: A\n")}, Err: ErrNoPackages},
+	} {
+		if err := b.Submit(ctx, test.Build); !errors.Is(err, test.Err) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Err, err)
+		}
+	}
+
+	if expected := []buildRequest{{
+		Path:         "users/userA/envA-1",
+		SpackVersion: "0.21",
+		Description:  "A",
+		Packages:     []string{"packageA@1", "packageB"},
+	}}; !reflect.DeepEqual(received, expected) {
+		t.Errorf("expecting requests %v, got %v", expected, received)
+	}
+
+	for n, test := range [...]struct {
+		Path   string
+		Status Status
+		Err    error
+	}{
+		{Path: "users/userA/envA-1", Status: Status{Path: "users/userA/envA-1", State: Building, Started: started}},
+		{Path: "users/userA/unknown", Err: ErrUnknownBuild},
+		{Path: "users/userA/broken", Err: ErrBadResponse},
+	} {
+		status, err := b.Status(ctx, test.Path)
+		if !errors.Is(err, test.Err) {
+			t.Errorf("test %d: expecting error %v, got %v", n+1, test.Err, err)
+		} else if err == nil && !reflect.DeepEqual(status, test.Status) {
+			t.Errorf("test %d: expecting status %v, got %v", n+1, test.Status, status)
+		}
+	}
+}
@@ -3,29 +3,88 @@ package compressed
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"io"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 	"vimagination.zapto.org/httpencoding"
 )
 
-var isGzip = httpencoding.HandlerFunc(func(enc httpencoding.Encoding) bool { return enc == "gzip" }) //nolint:gochecknoglobals
+type Encoding struct {
+	name   httpencoding.Encoding
+	writer func(io.Writer) io.WriteCloser
+}
 
-type File struct {
-	name string
+var (
+	Brotli = Encoding{ //nolint:gochecknoglobals
+		name: "br",
+		writer: func(w io.Writer) io.WriteCloser {
+			return brotli.NewWriter(w)
+		},
+	}
+	Zstd = Encoding{ //nolint:gochecknoglobals
+		name: "zstd",
+		writer: func(w io.Writer) io.WriteCloser {
+			z, _ := zstd.NewWriter(w) //nolint:errcheck
+
+			return z
+		},
+	}
+	Gzip = Encoding{ //nolint:gochecknoglobals
+		name: "gzip",
+		writer: func(w io.Writer) io.WriteCloser {
+			return gzip.NewWriter(w)
+		},
+	}
+
+	defaultEncodings = []Encoding{Brotli, Zstd, Gzip} //nolint:gochecknoglobals
+)
+
+const defaultCacheControl = "no-cache"
+
+type variant struct {
+	data []byte
+	etag string
+}
+
+func newVariant(data []byte) *variant {
+	sum := sha256.Sum256(data)
 
-	mu                       sync.RWMutex
-	compressed, uncompressed []byte
-	modTime                  time.Time
+	return &variant{
+		data: data,
+		etag: `"` + base64.RawURLEncoding.EncodeToString(sum[:]) + `"`,
+	}
+}
+
+type File struct {
+	name         string
+	encodings    []Encoding
+	cacheControl string
+
+	mu           sync.RWMutex
+	variants     map[httpencoding.Encoding]*variant
+	uncompressed []byte
+	modTime      time.Time
+	version      uint64
+	onChange     func(Update)
 }
 
-func New(name string) *File {
-	return &File{
+func New(name string, opts ...Option) *File {
+	f := &File{
 		name: name,
 	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	return f
 }
 
 func (f *File) ReadFrom(r io.Reader) (int64, error) {
@@ -53,36 +112,101 @@ func (f *File) writeData(p []byte) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	if bytes.Equal(p, f.uncompressed) {
+	if f.variants != nil && bytes.Equal(p, f.uncompressed) {
 		return
 	}
 
-	var compressed bytes.Buffer
-
-	g := gzip.NewWriter(&compressed)
+	encodings := f.encodingList()
+	variants := make(map[httpencoding.Encoding]*variant, len(encodings)+1)
+	variants[""] = newVariant(p)
 
-	g.Write(p) //nolint:errcheck
-	g.Close()
+	for _, enc := range encodings {
+		variants[enc.name] = newVariant(compress(enc, p))
+	}
 
 	f.modTime = time.Now()
-	f.compressed = compressed.Bytes()
+	f.variants = variants
 	f.uncompressed = p
+	f.version++
+
+	if f.onChange != nil {
+		f.onChange(Update{Version: f.version, Data: p})
+	}
+}
+
+func (f *File) encodingList() []Encoding {
+	if len(f.encodings) == 0 {
+		return defaultEncodings
+	}
+
+	return f.encodings
+}
+
+func compress(enc Encoding, p []byte) []byte {
+	var buf bytes.Buffer
+
+	w := enc.writer(&buf)
+
+	w.Write(p) //nolint:errcheck
+	w.Close()
+
+	return buf.Bytes()
 }
 
 func (f *File) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	var br *bytes.Reader
+	var (
+		v        *variant
+		encoding httpencoding.Encoding
+	)
 
 	f.mu.RLock()
 
-	if httpencoding.HandleEncoding(r, isGzip) {
-		br = bytes.NewReader(f.compressed)
+	ok := httpencoding.HandleEncoding(r, httpencoding.HandlerFunc(func(enc httpencoding.Encoding) bool {
+		switch enc {
+		case "", "identity":
+			enc = ""
+		case "*":
+			enc = ""
+
+			for _, e := range f.encodingList() {
+				if _, ok := f.variants[e.name]; ok {
+					enc = e.name
+
+					break
+				}
+			}
+		}
+
+		v, encoding = f.variants[enc], enc
+
+		return v != nil
+	}))
 
-		w.Header().Add("Content-Encoding", "gzip")
+	modTime := f.modTime
+
+	f.mu.RUnlock()
+
+	h := w.Header()
+
+	h.Add("Vary", "Accept-Encoding")
+
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+
+		return
+	}
+
+	if f.cacheControl == "" {
+		h.Set("Cache-Control", defaultCacheControl)
 	} else {
-		br = bytes.NewReader(f.uncompressed)
+		h.Set("Cache-Control", f.cacheControl)
 	}
 
-	f.mu.RUnlock()
+	h.Set("ETag", v.etag)
+
+	if encoding != "" {
+		h.Add("Content-Encoding", string(encoding))
+	}
 
-	http.ServeContent(w, r, f.name, f.modTime, br)
+	http.ServeContent(w, r, f.name, modTime, bytes.NewReader(v.data))
 }
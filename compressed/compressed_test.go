@@ -1,10 +1,15 @@
 package compressed
 
 import (
+	"compress/gzip"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 )
 
 func TestFile(t *testing.T) {
@@ -57,3 +62,152 @@ func readData(t *testing.T, url string) string {
 
 	return out
 }
+
+func TestEncodings(t *testing.T) {
+	const testData = "MY DATA"
+
+	all := New("file.json")
+	gzipOnly := New("file.json", Encodings(Gzip))
+
+	all.Encode(testData)
+	gzipOnly.Encode(testData)
+
+	allServer := httptest.NewServer(all)
+	gzipServer := httptest.NewServer(gzipOnly)
+
+	for n, test := range [...]struct {
+		URL, AcceptEncoding, Encoding string
+		Status                        int
+	}{
+		{URL: allServer.URL, Encoding: ""},
+		{URL: allServer.URL, AcceptEncoding: "br", Encoding: "br"},
+		{URL: allServer.URL, AcceptEncoding: "zstd", Encoding: "zstd"},
+		{URL: allServer.URL, AcceptEncoding: "gzip", Encoding: "gzip"},
+		{URL: allServer.URL, AcceptEncoding: "gzip;q=0.5, br", Encoding: "br"},
+		{URL: allServer.URL, AcceptEncoding: "zstd, gzip;q=0.8", Encoding: "zstd"},
+		{URL: allServer.URL, AcceptEncoding: "deflate", Encoding: ""},
+		{URL: allServer.URL, AcceptEncoding: "deflate, identity;q=0", Status: http.StatusNotAcceptable},
+		{URL: gzipServer.URL, AcceptEncoding: "br", Encoding: ""},
+		{URL: gzipServer.URL, AcceptEncoding: "br, gzip;q=0.5", Encoding: "gzip"},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, test.URL, nil)
+
+		req.Header.Set("Accept-Encoding", test.AcceptEncoding)
+
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		if test.Status == 0 {
+			test.Status = http.StatusOK
+		}
+
+		if resp.StatusCode != test.Status {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, test.Status, resp.StatusCode)
+
+			continue
+		} else if vary := resp.Header.Get("Vary"); vary != "Accept-Encoding" {
+			t.Errorf("test %d: expecting Vary header %q, got %q", n+1, "Accept-Encoding", vary)
+		}
+
+		if test.Status != http.StatusOK {
+			continue
+		}
+
+		if enc := resp.Header.Get("Content-Encoding"); enc != test.Encoding {
+			t.Errorf("test %d: expecting encoding %q, got %q", n+1, test.Encoding, enc)
+
+			continue
+		}
+
+		var r io.Reader = resp.Body
+
+		switch test.Encoding {
+		case "br":
+			r = brotli.NewReader(r)
+		case "zstd":
+			z, _ := zstd.NewReader(r)
+
+			defer z.Close()
+
+			r = z
+		case "gzip":
+			r, _ = gzip.NewReader(r)
+		}
+
+		var out string
+
+		if err := json.NewDecoder(r).Decode(&out); err != nil {
+			t.Errorf("test %d: unexpected error decoding data: %s", n+1, err)
+		} else if out != testData {
+			t.Errorf("test %d: expected to read %q, got %q", n+1, testData, out)
+		}
+	}
+}
+
+func TestETags(t *testing.T) {
+	f := New("file.json", CacheControl("max-age=60"))
+
+	f.Encode("MY DATA")
+
+	s := httptest.NewServer(f)
+	etags := make(map[string]string)
+
+	for n, encoding := range [...]string{"", "br", "zstd", "gzip"} {
+		resp := request(t, s.URL, encoding, "")
+
+		etag := resp.Header.Get("ETag")
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, http.StatusOK, resp.StatusCode)
+		} else if cc := resp.Header.Get("Cache-Control"); cc != "max-age=60" {
+			t.Errorf("test %d: expecting Cache-Control %q, got %q", n+1, "max-age=60", cc)
+		} else if etag == "" {
+			t.Errorf("test %d: expecting ETag", n+1)
+		} else if other, ok := etags[etag]; ok {
+			t.Errorf("test %d: ETag for encoding %q matches encoding %q", n+1, encoding, other)
+		} else if resp = request(t, s.URL, encoding, etag); resp.StatusCode != http.StatusNotModified {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, http.StatusNotModified, resp.StatusCode)
+		}
+
+		etags[etag] = encoding
+	}
+
+	for etag, encoding := range etags {
+		if resp := request(t, s.URL, encoding, etag); resp.StatusCode != http.StatusNotModified {
+			t.Errorf("expecting status %d for encoding %q, got %d", http.StatusNotModified, encoding, resp.StatusCode)
+		}
+	}
+
+	f.Encode("NEW DATA")
+
+	for etag, encoding := range etags {
+		if resp := request(t, s.URL, encoding, etag); resp.StatusCode != http.StatusOK {
+			t.Errorf("expecting status %d for encoding %q, got %d", http.StatusOK, encoding, resp.StatusCode)
+		} else if newETag := resp.Header.Get("ETag"); newETag == etag {
+			t.Errorf("expecting ETag for encoding %q to change", encoding)
+		}
+	}
+}
+
+func request(t *testing.T, url, encoding, etag string) *http.Response {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+
+	req.Header.Set("Accept-Encoding", encoding)
+
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	resp.Body.Close()
+
+	return resp
+}
@@ -0,0 +1,19 @@
+package compressed
+
+type Option func(*File)
+
+// Encodings sets the encodings that will be precomputed for the file, which
+// defaults to brotli, zstd and gzip.
+func Encodings(encodings ...Encoding) Option {
+	return func(f *File) {
+		f.encodings = encodings
+	}
+}
+
+// CacheControl sets the Cache-Control header sent with the file, which
+// defaults to requiring revalidation on every use.
+func CacheControl(cacheControl string) Option {
+	return func(f *File) {
+		f.cacheControl = cacheControl
+	}
+}
@@ -0,0 +1,67 @@
+package compressed
+
+import "sync"
+
+type Update struct {
+	Version uint64
+	Data    []byte
+}
+
+// Snapshot is a File that keeps track of how many times its contents have
+// changed, and sends the new contents to any subscribers whenever they do.
+type Snapshot struct {
+	*File
+
+	mu          sync.Mutex
+	subscribers map[chan Update]struct{}
+}
+
+func NewSnapshot(name string, opts ...Option) *Snapshot {
+	s := &Snapshot{
+		File:        New(name, opts...),
+		subscribers: make(map[chan Update]struct{}),
+	}
+
+	s.File.onChange = s.notify
+
+	return s
+}
+
+func (s *Snapshot) Current() Update {
+	s.File.mu.RLock()
+	defer s.File.mu.RUnlock()
+
+	return Update{Version: s.version, Data: s.uncompressed}
+}
+
+// Subscribe returns a channel that will receive the contents of the snapshot
+// each time it changes, and a function to cancel the subscription.
+//
+// Slow subscribers will only receive the latest update.
+func (s *Snapshot) Subscribe() (<-chan Update, func()) {
+	ch := make(chan Update, 1)
+
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		delete(s.subscribers, ch)
+		s.mu.Unlock()
+	}
+}
+
+func (s *Snapshot) notify(u Update) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ch := range s.subscribers {
+		select {
+		case <-ch:
+		default:
+		}
+
+		ch <- u
+	}
+}
@@ -0,0 +1,60 @@
+package compressed
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	s := NewSnapshot("snapshot.json")
+
+	ch, cancel := s.Subscribe()
+
+	s.Encode("A")
+
+	if u := readUpdate(t, ch); u.Version != 1 || string(u.Data) != "\"A\"\n" {
+		t.Errorf("expecting update 1 with data %q, got %d, %q", "\"A\"\n", u.Version, u.Data)
+	}
+
+	s.Encode("A")
+
+	select {
+	case u := <-ch:
+		t.Errorf("unexpected update: %v", u)
+	default:
+	}
+
+	s.Encode("B")
+	s.Encode("C")
+
+	if u := readUpdate(t, ch); u.Version != 3 || string(u.Data) != "\"C\"\n" {
+		t.Errorf("expecting update 3 with data %q, got %d, %q", "\"C\"\n", u.Version, u.Data)
+	}
+
+	if u := s.Current(); u.Version != 3 || string(u.Data) != "\"C\"\n" {
+		t.Errorf("expecting current version 3 with data %q, got %d, %q", "\"C\"\n", u.Version, u.Data)
+	}
+
+	cancel()
+
+	s.Encode("D")
+
+	select {
+	case u := <-ch:
+		t.Errorf("unexpected update after cancel: %v", u)
+	default:
+	}
+}
+
+func readUpdate(t *testing.T, ch <-chan Update) Update {
+	t.Helper()
+
+	select {
+	case u := <-ch:
+		return u
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for update")
+	}
+
+	return Update{}
+}
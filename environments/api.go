@@ -0,0 +1,798 @@
+package environments
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/wtsi-hgi/softpack-frontend/artefacts"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	listPath = "GET /environments"
+	envPath  = "GET /environment/{usersOrGroups}/{owner}/{env}"
+	filePath = "GET /environment/{usersOrGroups}/{owner}/{env}/{file}"
+
+	historyPath  = "GET /history/{usersOrGroups}/{owner}/{env}"
+	revisionPath = "GET /revision/{usersOrGroups}/{owner}/{env}/{revision}"
+	diffPath     = "GET /diff/{usersOrGroups}/{owner}/{env}"
+
+	deletedPath = "GET /deleted"
+	restorePath = "POST /restore/{usersOrGroups}/{owner}/{env}"
+
+	invalidPath    = "GET /admin/invalid"
+	unverifiedPath = "GET /admin/unverified"
+	statusPath     = "POST /status/{usersOrGroups}/{owner}/{env}"
+
+	logPath = "POST /log/{usersOrGroups}/{owner}/{env}"
+
+	treePath   = "GET /tree/"
+	treePrefix = "/tree"
+
+	defaultDeletedLimit = 100
+	maxStatusLength     = 64
+	maxLogChunkLength   = 1 << 20
+
+	bearerPrefix = "Bearer "
+)
+
+var fileContentTypes = map[string]string{ //nolint:gochecknoglobals
+	environmentsFile: "text/yaml; charset=utf-8",
+	metaFile:         "text/yaml; charset=utf-8",
+	readmeFile:       "text/markdown; charset=utf-8",
+	moduleFile:       "text/plain; charset=utf-8",
+	builderOut:       "text/plain; charset=utf-8",
+	singularityFile:  "text/plain; charset=utf-8",
+}
+
+type filter struct {
+	owners, tags, packages, statuses []string
+}
+
+func filterFromRequest(r *http.Request) filter {
+	q := r.URL.Query()
+
+	return filter{
+		owners:   q["owner"],
+		tags:     q["tag"],
+		packages: q["package"],
+		statuses: q["status"],
+	}
+}
+
+func (f *filter) matches(p string, e *environment) bool {
+	return matchAny(f.owners, func(owner string) bool { return ownerFromPath(p) == owner }) &&
+		matchAny(f.tags, func(tag string) bool { return slices.Contains(e.Tags, tag) }) &&
+		matchAny(f.packages, func(pkg string) bool { return hasPackage(e.Packages, pkg) }) &&
+		matchAny(f.statuses, func(status string) bool { return e.Status.String() == status })
+}
+
+func matchAny(values []string, fn func(string) bool) bool {
+	return len(values) == 0 || slices.ContainsFunc(values, fn)
+}
+
+func ownerFromPath(p string) string {
+	_, rest, _ := strings.Cut(p, "/")
+	owner, _, _ := strings.Cut(rest, "/")
+
+	return owner
+}
+
+func hasPackage(packages []string, pkg string) bool {
+	for _, p := range packages {
+		if p == pkg {
+			return true
+		}
+
+		if name, _, ok := strings.Cut(p, "@"); ok && name == pkg {
+			return true
+		}
+	}
+
+	return false
+}
+
+var sortFuncs = map[string]func(a, b *environment) int{ //nolint:gochecknoglobals
+	"name":    func(a, b *environment) int { return strings.Compare(a.Name, b.Name) },
+	"owner":   func(a, b *environment) int { return strings.Compare(a.Owner, b.Owner) },
+	"created": func(a, b *environment) int { return a.Created.Compare(b.Created) },
+	"updated": func(a, b *environment) int { return a.Updated.Compare(b.Updated) },
+	"buildDuration": func(a, b *environment) int {
+		return cmp.Compare(a.BuildDuration, b.BuildDuration)
+	},
+}
+
+type sortedEnvironment struct {
+	Path string
+	*environment
+}
+
+// handleList responds with a list of the environments matching the filter in
+// the request, with each entry including its path.
+//
+// The list is ordered by path or, if a sort key is given, by that key, and is
+// reversed if the order is "desc".
+func (e *Environments) handleList(w http.ResponseWriter, r *http.Request) {
+	f := filterFromRequest(r)
+	sortBy := r.URL.Query().Get("sort")
+
+	fn, ok := sortFuncs[sortBy]
+	if sortBy != "" && !ok {
+		http.Error(w, "unknown sort key", http.StatusBadRequest)
+
+		return
+	}
+
+	e.mu.RLock()
+	data, err := e.listJSON(f, fn, r.URL.Query().Get("order") == "desc")
+	e.mu.RUnlock()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	writeRawJSON(w, data)
+}
+
+// listJSON encodes the environments matching the filter, and so must be
+// called with the lock held.
+func (e *Environments) listJSON(f filter, fn func(a, b *environment) int, desc bool) ([]byte, error) {
+	sorted := make([]sortedEnvironment, 0, len(e.environments))
+
+	for p, env := range e.environments {
+		if f.matches(p, env) {
+			sorted = append(sorted, sortedEnvironment{Path: p, environment: env})
+		}
+	}
+
+	slices.SortFunc(sorted, func(a, b sortedEnvironment) int {
+		var c int
+
+		if fn != nil {
+			c = fn(a.environment, b.environment)
+		}
+
+		c = cmp.Or(c, strings.Compare(a.Path, b.Path))
+		if desc {
+			return -c
+		}
+
+		return c
+	})
+
+	return json.Marshal(sorted)
+}
+
+type invalidEnvironment struct {
+	Path  string
+	Error string
+}
+
+func (e *Environments) handleInvalid(w http.ResponseWriter, r *http.Request) {
+	if !e.isAdmin(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+
+		return
+	}
+
+	invalid := []invalidEnvironment{}
+
+	e.mu.RLock()
+
+	for p, env := range e.environments {
+		if env.Status == envInvalid {
+			invalid = append(invalid, invalidEnvironment{Path: p, Error: env.Error})
+		}
+	}
+
+	e.mu.RUnlock()
+
+	slices.SortFunc(invalid, func(a, b invalidEnvironment) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	writeJSON(w, invalid)
+}
+
+// handleUnverified lists the commits pulled from the remote whose signatures
+// could not be verified.
+func (e *Environments) handleUnverified(w http.ResponseWriter, r *http.Request) {
+	if !e.isAdmin(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+
+		return
+	}
+
+	vs, ok := e.artefacts.(verifyStore)
+	if !ok {
+		notImplemented(w)
+
+		return
+	}
+
+	unverified := vs.Unverified()
+	if unverified == nil {
+		unverified = []string{}
+	}
+
+	writeJSON(w, unverified)
+}
+
+func envPathFromRequest(r *http.Request) (string, bool) {
+	usersOrGroups := r.PathValue("usersOrGroups")
+
+	return path.Join(usersOrGroups, r.PathValue("owner"), r.PathValue("env")),
+		usersOrGroups == artefacts.UserDirectory || usersOrGroups == artefacts.GroupDirectory
+}
+
+func (e *Environments) handleEnvironment(w http.ResponseWriter, r *http.Request) {
+	p, ok := envPathFromRequest(r)
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	e.mu.RLock()
+	env, ok := e.environments[p]
+
+	var (
+		data []byte
+		err  error
+	)
+
+	if ok {
+		data, err = json.Marshal(env)
+	}
+
+	e.mu.RUnlock()
+
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	writeRawJSON(w, data)
+}
+
+func (e *Environments) handleFile(w http.ResponseWriter, r *http.Request) {
+	if _, ok := envPathFromRequest(r); !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	name := r.PathValue("file")
+
+	f, err := e.artefacts.GetFile(r.PathValue("usersOrGroups"), r.PathValue("owner"), r.PathValue("env"), name)
+	if isNotFound(err) {
+		http.NotFound(w, r)
+
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	if contentType, ok := fileContentTypes[name]; ok {
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	rs, ok := f.(io.ReadSeeker)
+	if ok {
+		_, err = rs.Seek(0, io.SeekCurrent)
+	}
+
+	if !ok || err != nil {
+		io.Copy(w, f) //nolint:errcheck
+
+		return
+	}
+
+	http.ServeContent(w, r, name, fi.ModTime(), rs)
+}
+
+func (e *Environments) handleHistory(w http.ResponseWriter, r *http.Request) {
+	hs, ok := e.artefacts.(historyStore)
+	if !ok {
+		notImplemented(w)
+
+		return
+	}
+
+	if _, ok := envPathFromRequest(r); !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	revisions, err := hs.History(r.PathValue("usersOrGroups"), r.PathValue("owner"), r.PathValue("env"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	} else if len(revisions) == 0 {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	writeJSON(w, revisions)
+}
+
+func (e *Environments) handleRevision(w http.ResponseWriter, r *http.Request) {
+	hs, ok := e.artefacts.(historyStore)
+	if !ok {
+		notImplemented(w)
+
+		return
+	}
+
+	hash, ok := parseRevision(r.PathValue("revision"))
+	if _, isEnv := envPathFromRequest(r); !isEnv || !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	as, err := hs.GetEnvAt(hash, r.PathValue("usersOrGroups"), r.PathValue("owner"), r.PathValue("env"))
+	if isNotFound(err) {
+		http.NotFound(w, r)
+
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	defer as.Close()
+
+	env, err := environmentFromArtefacts(as)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+
+		return
+	}
+
+	env.setLocation(envLocation{usersOrGroups: r.PathValue("usersOrGroups"), owner: r.PathValue("owner"), name: r.PathValue("env")})
+
+	writeJSON(w, env)
+}
+
+func (e *Environments) handleDiff(w http.ResponseWriter, r *http.Request) {
+	hs, ok := e.artefacts.(historyStore)
+	if !ok {
+		notImplemented(w)
+
+		return
+	}
+
+	if _, ok := envPathFromRequest(r); !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	q := r.URL.Query()
+
+	from, ok := parseRevision(q.Get("from"))
+	if !ok {
+		http.Error(w, "invalid from revision", http.StatusBadRequest)
+
+		return
+	}
+
+	var to plumbing.Hash
+
+	if toRev := q.Get("to"); toRev != "" {
+		if to, ok = parseRevision(toRev); !ok {
+			http.Error(w, "invalid to revision", http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	diff, err := hs.DiffFile(from, to, r.PathValue("usersOrGroups"), r.PathValue("owner"), r.PathValue("env"), environmentsFile)
+	if isNotFound(err) {
+		http.NotFound(w, r)
+
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+	io.WriteString(w, diff) //nolint:errcheck
+}
+
+func (e *Environments) handleDeleted(w http.ResponseWriter, r *http.Request) {
+	rs, ok := e.artefacts.(restoreStore)
+	if !ok {
+		notImplemented(w)
+
+		return
+	}
+
+	limit := defaultDeletedLimit
+
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+
+		if limit, err = strconv.Atoi(l); err != nil {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	deleted, err := rs.Deleted(limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	writeJSON(w, deleted)
+}
+
+func (e *Environments) handleRestore(w http.ResponseWriter, r *http.Request) {
+	rs, ok := e.artefacts.(restoreStore)
+	if !ok {
+		notImplemented(w)
+
+		return
+	}
+
+	p, ok := envPathFromRequest(r)
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	usersOrGroups, owner, name := r.PathValue("usersOrGroups"), r.PathValue("owner"), r.PathValue("env")
+
+	if err := rs.RestoreEnvironment(e.actingUser(r), usersOrGroups, owner, name); errors.Is(err, artefacts.ErrNotDeleted) {
+		http.NotFound(w, r)
+
+		return
+	} else if errors.Is(err, artefacts.ErrEnvironmentExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	env, err := e.loadEnvironment(usersOrGroups, owner, name)
+	if env == nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	e.setEnvironment(p, env)
+
+	writeJSON(w, env)
+}
+
+// handleSetStatus moves an environment to the status given in the request body,
+// recording it in the environment metadata.
+//
+// Only the ready, deprecated and archived states can be set this way, as the
+// others are determined by the builder, and only by admins.
+//
+// Status changes are made one at a time, and the stored environment is only
+// replaced if it has not been reloaded from the artefacts in the meantime.
+func (e *Environments) handleSetStatus(w http.ResponseWriter, r *http.Request) {
+	if !e.isAdmin(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+
+		return
+	}
+
+	p, ok := envPathFromRequest(r)
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	var status envStatus
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxStatusLength))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	} else if err = status.UnmarshalText(bytes.TrimSpace(body)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	} else if status != envReady && status != envDeprecated && status != envArchived {
+		http.Error(w, ErrStatusNotSettable.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	e.statusMu.Lock()
+	defer e.statusMu.Unlock()
+
+	e.mu.RLock()
+	prev := e.environments[p]
+	e.mu.RUnlock()
+
+	if prev == nil {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	env := *prev
+	env.Transitions = slices.Clone(prev.Transitions)
+
+	if err = env.setStatus(status, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+
+		return
+	}
+
+	usersOrGroups, owner, name := r.PathValue("usersOrGroups"), r.PathValue("owner"), r.PathValue("env")
+
+	metadata, err := e.metaWithStatus(usersOrGroups, owner, name, status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	if err = e.artefacts.AddFilesToEnv(e.actingUser(r), usersOrGroups, owner, name, map[string]io.Reader{
+		metaFile: bytes.NewReader(metadata),
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	e.mu.Lock()
+	replace := e.environments[p] == prev
+
+	if replace {
+		e.environments[p] = &env
+	}
+	e.mu.Unlock()
+
+	if replace {
+		e.updateJSON()
+	}
+
+	writeJSON(w, &env)
+}
+
+// metaWithStatus returns the environment metadata file with the status field
+// updated, preserving any other fields.
+func (e *Environments) metaWithStatus(usersOrGroups, owner, name string, status envStatus) ([]byte, error) {
+	metadata := make(map[string]any)
+
+	f, err := e.artefacts.GetFile(usersOrGroups, owner, name, metaFile)
+	if err == nil {
+		err = yaml.NewDecoder(f).Decode(&metadata)
+
+		f.Close()
+	}
+
+	if err != nil && !isNotFound(err) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if status == envReady {
+		delete(metadata, "status")
+	} else {
+		metadata["status"] = status.String()
+	}
+
+	return yaml.Marshal(metadata)
+}
+
+// handleTree serves the committed artefacts repository as a file tree, at the
+// head or at the commit given by the revision query parameter.
+func (e *Environments) handleTree(w http.ResponseWriter, r *http.Request) {
+	fsys, ok := e.artefacts.(fsStore)
+	if !ok {
+		notImplemented(w)
+
+		return
+	}
+
+	var (
+		cfs *artefacts.CommitFS
+		err error
+	)
+
+	if rev := r.URL.Query().Get("revision"); rev == "" {
+		cfs, err = fsys.FS()
+	} else if hash, ok := parseRevision(rev); !ok {
+		http.Error(w, "invalid revision", http.StatusBadRequest)
+
+		return
+	} else {
+		cfs, err = fsys.FSAt(hash)
+	}
+
+	if isNotFound(err) {
+		http.NotFound(w, r)
+
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	http.StripPrefix(treePrefix, http.FileServerFS(cfs)).ServeHTTP(w, r)
+}
+
+// handleLog receives a chunk of a build log from a builder and streams it to
+// any websocket connections subscribed to the environment.
+//
+// When the final query parameter is set, the whole log is stored as the
+// environment builder.out. As a builder.out without a module marks a build as
+// failed, the final parameter must either be "failed", or the module of the
+// successful build must already have been stored.
+//
+// Requests must bear the configured builder token.
+func (e *Environments) handleLog(w http.ResponseWriter, r *http.Request) {
+	if len(e.builderToken) == 0 {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	if !e.isBuilder(r) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+		return
+	}
+
+	p, ok := envPathFromRequest(r)
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	e.mu.RLock()
+	_, ok = e.environments[p]
+	e.mu.RUnlock()
+
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	chunk, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxLogChunkLength))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+
+		if errors.As(err, &maxErr) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+
+		return
+	}
+
+	log := e.logs.append(p, chunk)
+
+	if !r.URL.Query().Has("final") {
+		return
+	}
+
+	if r.URL.Query().Get("final") != envFailed.String() {
+		f, err := e.artefacts.GetFile(r.PathValue("usersOrGroups"), r.PathValue("owner"), r.PathValue("env"), moduleFile)
+		if err != nil {
+			http.Error(w, ErrBuildResultMissing.Error(), http.StatusConflict)
+
+			return
+		}
+
+		f.Close()
+	}
+
+	if err = e.artefacts.AddFilesToEnv(e.actingUser(r), r.PathValue("usersOrGroups"), r.PathValue("owner"), r.PathValue("env"), map[string]io.Reader{
+		builderOut: bytes.NewReader(log),
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	e.logs.finish(p)
+}
+
+func notImplemented(w http.ResponseWriter) {
+	http.Error(w, http.StatusText(http.StatusNotImplemented), http.StatusNotImplemented)
+}
+
+// actingUser returns the user responsible for the request, as set by a trusted
+// proxy in the configured UserHeader.
+//
+// Without a UserHeader the user cannot be identified, so an empty Author is
+// returned and changes are attributed to the committer.
+func (e *Environments) actingUser(r *http.Request) artefacts.Author {
+	if e.userHeader == "" {
+		return artefacts.Author{}
+	}
+
+	return artefacts.Author{Name: r.Header.Get(e.userHeader)}
+}
+
+// isAdmin reports whether the request was made by an admin, which requires the
+// user to have been identified by a trusted proxy.
+func (e *Environments) isAdmin(r *http.Request) bool {
+	return e.userHeader != "" && slices.Contains(e.admins, r.Header.Get(e.userHeader))
+}
+
+func (e *Environments) isBuilder(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), bearerPrefix)
+
+	return ok && subtle.ConstantTimeCompare([]byte(token), e.builderToken) == 1
+}
+
+func parseRevision(rev string) (plumbing.Hash, bool) {
+	if !plumbing.IsHash(rev) {
+		return plumbing.ZeroHash, false
+	}
+
+	return plumbing.NewHash(rev), true
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, plumbing.ErrObjectNotFound) || errors.Is(err, object.ErrDirectoryNotFound) || errors.Is(err, object.ErrFileNotFound)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v) //nolint:errcheck
+}
+
+func writeRawJSON(w http.ResponseWriter, data []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data) //nolint:errcheck
+}
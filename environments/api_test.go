@@ -0,0 +1,470 @@
+package environments
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/wtsi-hgi/softpack-frontend/artefacts"
+	"github.com/wtsi-hgi/softpack-frontend/internal/git"
+)
+
+var apiFiles = map[string]string{
+	artefacts.Environments + "/users/userA/envA-1/" + environmentsFile:   "description: A\npackages:\n - packageA@1\n - packageB@2\n",
+	artefacts.Environments + "/users/userA/envA-1/" + readmeFile:         "README A",
+	artefacts.Environments + "/users/userA/envA-1/" + moduleFile:         "MODULE A",
+	artefacts.Environments + "/users/userA/envA-1/" + metaFile:           "tags:\n - tagA\nbuild:\n host: hostA\n duration: 1m30s\n",
+	artefacts.Environments + "/users/userB/envB-1/" + environmentsFile:   "description: B\npackages:\n - packageB@3\n",
+	artefacts.Environments + "/users/userB/envB-1/" + builderOut:         "FAILED",
+	artefacts.Environments + "/groups/groupC/envC-1/" + environmentsFile: "description: C\npackages:\n - packageC\n",
+}
+
+func newTestServer(t *testing.T, files map[string]string, opts ...Option) (*Environments, *httptest.Server) {
+	t.Helper()
+
+	g := git.New(t)
+	g.Add(t, files)
+
+	a, err := artefacts.New(artefacts.Remote(g.URL()))
+	if err != nil {
+		t.Fatalf("unexpected error creating artefacts: %s", err)
+	}
+
+	e, err := New(a, opts...)
+	if err != nil {
+		t.Fatalf("unexpected error creating environments: %s", err)
+	}
+
+	return e, httptest.NewServer(e)
+}
+
+func TestList(t *testing.T) {
+	_, s := newTestServer(t, apiFiles)
+
+	for n, test := range [...]struct {
+		Query       string
+		Expectation []string
+	}{
+		{Expectation: []string{"groups/groupC/envC-1", "users/userA/envA-1", "users/userB/envB-1"}},
+		{Query: "?owner=userA", Expectation: []string{"users/userA/envA-1"}},
+		{Query: "?owner=userA&owner=groupC", Expectation: []string{"groups/groupC/envC-1", "users/userA/envA-1"}},
+		{Query: "?tag=tagA", Expectation: []string{"users/userA/envA-1"}},
+		{Query: "?tag=tagB", Expectation: []string{}},
+		{Query: "?package=packageB", Expectation: []string{"users/userA/envA-1", "users/userB/envB-1"}},
+		{Query: "?package=packageB@3", Expectation: []string{"users/userB/envB-1"}},
+		{Query: "?package=packageB&owner=userB", Expectation: []string{"users/userB/envB-1"}},
+		{Query: "?status=ready", Expectation: []string{"users/userA/envA-1"}},
+		{Query: "?status=failed", Expectation: []string{"users/userB/envB-1"}},
+		{Query: "?status=building", Expectation: []string{"groups/groupC/envC-1"}},
+	} {
+		var envs []struct{ Path string }
+
+		resp, err := http.Get(s.URL + "/environments" + test.Query)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		} else if err = json.NewDecoder(resp.Body).Decode(&envs); err != nil {
+			t.Fatalf("test %d: unexpected error decoding response: %s", n+1, err)
+		}
+
+		resp.Body.Close()
+
+		paths := make([]string, len(envs))
+
+		for m, env := range envs {
+			paths[m] = env.Path
+		}
+
+		if !slices.Equal(paths, test.Expectation) {
+			t.Errorf("test %d: expecting environments %v, got %v", n+1, test.Expectation, paths)
+		}
+	}
+}
+
+func TestGetEnvironment(t *testing.T) {
+	_, s := newTestServer(t, apiFiles)
+
+	for n, test := range [...]struct {
+		Path        string
+		Status      int
+		Expectation *environment
+	}{
+		{
+			Path:   "/environment/users/userA/envA-1",
+			Status: http.StatusOK,
+			Expectation: &environment{
+				OwnerKind:     ownerUser,
+				Owner:         "userA",
+				Name:          "envA-1",
+				Tags:          []string{"tagA"},
+				Packages:      []string{"packageA@1", "packageB@2"},
+				Description:   "A",
+				ReadMe:        "README A",
+				Status:        envReady,
+				Transitions:   []statusChange{{Status: envReady}},
+				BuildHost:     "hostA",
+				BuildDuration: 90,
+			},
+		},
+		{Path: "/environment/users/userA/envA-2", Status: http.StatusNotFound},
+		{Path: "/environment/other/userA/envA-1", Status: http.StatusNotFound},
+	} {
+		resp, err := http.Get(s.URL + test.Path)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		} else if resp.StatusCode != test.Status {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, test.Status, resp.StatusCode)
+		} else if test.Expectation != nil {
+			var env environment
+
+			if err = json.NewDecoder(resp.Body).Decode(&env); err != nil {
+				t.Fatalf("test %d: unexpected error decoding response: %s", n+1, err)
+			} else if env.Created.IsZero() || env.Updated.Before(env.Created) {
+				t.Errorf("test %d: expecting created and updated times, got %s and %s", n+1, env.Created, env.Updated)
+			}
+
+			clearEnvTimes(&env)
+
+			if !reflect.DeepEqual(&env, test.Expectation) {
+				t.Errorf("test %d: expecting environment %v, got %v", n+1, test.Expectation, env)
+			}
+		}
+	}
+}
+
+func TestListSorted(t *testing.T) {
+	_, s := newTestServer(t, apiFiles)
+
+	for n, test := range [...]struct {
+		Query       string
+		Status      int
+		Expectation []string
+	}{
+		{Query: "?sort=name", Status: http.StatusOK, Expectation: []string{"users/userA/envA-1", "users/userB/envB-1", "groups/groupC/envC-1"}},
+		{Query: "?sort=owner&order=desc", Status: http.StatusOK, Expectation: []string{"users/userB/envB-1", "users/userA/envA-1", "groups/groupC/envC-1"}},
+		{Query: "?sort=buildDuration&order=desc", Status: http.StatusOK, Expectation: []string{"users/userA/envA-1", "users/userB/envB-1", "groups/groupC/envC-1"}},
+		{Query: "?sort=name&owner=userA", Status: http.StatusOK, Expectation: []string{"users/userA/envA-1"}},
+		{Query: "?order=desc", Status: http.StatusOK, Expectation: []string{"users/userB/envB-1", "users/userA/envA-1", "groups/groupC/envC-1"}},
+		{Query: "?sort=unknown", Status: http.StatusBadRequest},
+	} {
+		resp, err := http.Get(s.URL + "/environments" + test.Query)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		var envs []struct{ Path string }
+
+		if resp.StatusCode != test.Status {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, test.Status, resp.StatusCode)
+		} else if test.Expectation != nil {
+			if err = json.NewDecoder(resp.Body).Decode(&envs); err != nil {
+				t.Errorf("test %d: unexpected error decoding response: %s", n+1, err)
+			}
+
+			paths := make([]string, len(envs))
+
+			for m, env := range envs {
+				paths[m] = env.Path
+			}
+
+			if !slices.Equal(paths, test.Expectation) {
+				t.Errorf("test %d: expecting environments %v, got %v", n+1, test.Expectation, paths)
+			}
+		}
+
+		resp.Body.Close()
+	}
+}
+
+func TestGetFileRange(t *testing.T) {
+	_, s := newTestServer(t, apiFiles)
+
+	req, _ := http.NewRequest(http.MethodGet, s.URL+"/environment/users/userA/envA-1/"+readmeFile, nil)
+
+	req.Header.Set("Range", "bytes=2-5")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Errorf("expecting status %d, got %d", http.StatusPartialContent, resp.StatusCode)
+	} else if string(body) != "ADME" {
+		t.Errorf("expecting body %q, got %q", "ADME", body)
+	} else if ct := resp.Header.Get("Content-Type"); ct != fileContentTypes[readmeFile] {
+		t.Errorf("expecting content type %q, got %q", fileContentTypes[readmeFile], ct)
+	} else if resp.Header.Get("Last-Modified") == "" {
+		t.Error("expecting Last-Modified header")
+	}
+}
+
+func TestGetFile(t *testing.T) {
+	_, s := newTestServer(t, apiFiles)
+
+	for n, test := range [...]struct {
+		Path, Expectation string
+		Status            int
+	}{
+		{Path: "/environment/users/userA/envA-1/" + moduleFile, Status: http.StatusOK, Expectation: "MODULE A"},
+		{Path: "/environment/users/userB/envB-1/" + builderOut, Status: http.StatusOK, Expectation: "FAILED"},
+		{Path: "/environment/users/userB/envB-1/" + moduleFile, Status: http.StatusNotFound},
+		{Path: "/environment/users/userB/envB-2/" + moduleFile, Status: http.StatusNotFound},
+	} {
+		resp, err := http.Get(s.URL + test.Path)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		} else if resp.StatusCode != test.Status {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, test.Status, resp.StatusCode)
+		} else if test.Status == http.StatusOK {
+			if body, err := io.ReadAll(resp.Body); err != nil {
+				t.Fatalf("test %d: unexpected error reading response: %s", n+1, err)
+			} else if string(body) != test.Expectation {
+				t.Errorf("test %d: expecting body %q, got %q", n+1, test.Expectation, body)
+			}
+		}
+	}
+}
+
+func TestTree(t *testing.T) {
+	_, s := newTestServer(t, apiFiles)
+
+	for n, test := range [...]struct {
+		Path        string
+		Status      int
+		Expectation string
+	}{
+		{Path: "/tree/environments/users/userA/envA-1/" + readmeFile, Status: http.StatusOK, Expectation: "README A"},
+		{Path: "/tree/environments/users/userA/envA-1/", Status: http.StatusOK, Expectation: readmeFile},
+		{Path: "/tree/environments/users/userA/envA-2/" + readmeFile, Status: http.StatusNotFound},
+		{Path: "/tree/?revision=abc", Status: http.StatusBadRequest},
+		{Path: "/tree/?revision=0123456789012345678901234567890123456789", Status: http.StatusNotFound},
+	} {
+		resp, err := http.Get(s.URL + test.Path)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+
+		resp.Body.Close()
+
+		if resp.StatusCode != test.Status {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, test.Status, resp.StatusCode)
+		} else if !strings.Contains(string(body), test.Expectation) {
+			t.Errorf("test %d: expecting body to contain %q, got %q", n+1, test.Expectation, body)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	e, s := newTestServer(t, apiFiles)
+
+	if err := e.artefacts.AddFilesToEnv(artefacts.Author{}, artefacts.UserDirectory, "userA", "envA-1", map[string]io.Reader{
+		environmentsFile: strings.NewReader("description: A2\npackages:\n - packageA@1\n"),
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var revisions []artefacts.Revision
+
+	resp, err := http.Get(s.URL + "/history/users/userA/envA-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if err = json.NewDecoder(resp.Body).Decode(&revisions); err != nil {
+		t.Fatalf("unexpected error decoding response: %s", err)
+	} else if len(revisions) != 5 {
+		t.Fatalf("expecting 5 revisions, got %d", len(revisions))
+	} else if files := revisions[0].Files; !slices.Equal(files, []string{environmentsFile}) {
+		t.Errorf("expecting latest revision to change %v, got %v", []string{environmentsFile}, files)
+	}
+
+	previous := revisions[1].Hash
+
+	for n, test := range [...]struct {
+		Path, Expectation string
+		Status            int
+	}{
+		{Path: "/history/users/userA/envA-2", Status: http.StatusNotFound},
+		{Path: "/revision/users/userA/envA-1/" + previous, Status: http.StatusOK, Expectation: "A"},
+		{Path: "/revision/users/userA/envA-1/" + revisions[0].Hash, Status: http.StatusOK, Expectation: "A2"},
+		{Path: "/revision/users/userA/envA-1/notahash", Status: http.StatusNotFound},
+		{Path: "/revision/users/userA/envA-2/" + previous, Status: http.StatusNotFound},
+		{Path: "/diff/users/userA/envA-1?from=" + previous, Status: http.StatusOK, Expectation: "-description: A\n+description: A2\n"},
+		{Path: "/diff/users/userA/envA-1?from=" + previous + "&to=" + previous, Status: http.StatusOK},
+		{Path: "/diff/users/userA/envA-1", Status: http.StatusBadRequest},
+		{Path: "/diff/users/userA/envA-1?from=" + previous + "&to=bad", Status: http.StatusBadRequest},
+	} {
+		resp, err := http.Get(s.URL + test.Path)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		} else if resp.StatusCode != test.Status {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, test.Status, resp.StatusCode)
+		} else if test.Status != http.StatusOK {
+			continue
+		} else if strings.HasPrefix(test.Path, "/revision/") {
+			var env environment
+
+			if err = json.NewDecoder(resp.Body).Decode(&env); err != nil {
+				t.Fatalf("test %d: unexpected error decoding response: %s", n+1, err)
+			} else if env.Description != test.Expectation {
+				t.Errorf("test %d: expecting description %q, got %q", n+1, test.Expectation, env.Description)
+			}
+		} else if body, _ := io.ReadAll(resp.Body); !strings.Contains(string(body), test.Expectation) {
+			t.Errorf("test %d: expecting diff to contain %q, got %q", n+1, test.Expectation, body)
+		} else if test.Expectation == "" && len(body) != 0 {
+			t.Errorf("test %d: expecting empty diff, got %q", n+1, body)
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	e, s := newTestServer(t, apiFiles)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+s.URL[4:]+socketPath, nil)
+	if err != nil {
+		t.Fatalf("unexpected error connecting to websocket: %s", err)
+	}
+
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	var r response
+
+	if err = conn.ReadJSON(&r); err != nil {
+		t.Fatalf("unexpected error reading from websocket: %s", err)
+	}
+
+	if err = e.artefacts.RemoveEnvironment(artefacts.Author{}, artefacts.UserDirectory, "userA", "envA-1"); err != nil {
+		t.Fatalf("unexpected error removing environment: %s", err)
+	}
+
+	var envs environments
+
+	if err = conn.ReadJSON(&r); err != nil {
+		t.Fatalf("unexpected error reading from websocket: %s", err)
+	} else if _, envs, err = decodeSnapshot(r); err != nil {
+		t.Fatalf("unexpected error decoding update: %s", err)
+	} else if _, ok := envs["users/userA/envA-1"]; ok {
+		t.Errorf("expecting update to not contain removed environment, got %v", envs)
+	}
+
+	var deleted []artefacts.DeletedEnvironment
+
+	resp, err := http.Get(s.URL + "/deleted")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if err = json.NewDecoder(resp.Body).Decode(&deleted); err != nil {
+		t.Fatalf("unexpected error decoding response: %s", err)
+	} else if len(deleted) != 1 || deleted[0].Path != "users/userA/envA-1" {
+		t.Fatalf("expecting deleted environment users/userA/envA-1, got %v", deleted)
+	}
+
+	for n, test := range [...]struct {
+		Path   string
+		Status int
+	}{
+		{Path: "/restore/users/userA/envA-1", Status: http.StatusOK},
+		{Path: "/restore/users/userA/envA-1", Status: http.StatusConflict},
+		{Path: "/restore/users/userA/envA-2", Status: http.StatusNotFound},
+		{Path: "/restore/other/userA/envA-1", Status: http.StatusNotFound},
+	} {
+		req, _ := http.NewRequest(http.MethodPost, s.URL+test.Path, nil)
+
+		req.SetBasicAuth("userA", "")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		} else if resp.StatusCode != test.Status {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, test.Status, resp.StatusCode)
+		}
+	}
+
+	envs = nil
+
+	if err = conn.ReadJSON(&r); err != nil {
+		t.Fatalf("unexpected error reading from websocket: %s", err)
+	} else if _, envs, err = decodeSnapshot(r); err != nil {
+		t.Fatalf("unexpected error decoding update: %s", err)
+	} else if env, ok := envs["users/userA/envA-1"]; !ok || env.Status != envReady || env.ReadMe != "README A" {
+		t.Errorf("expecting update to contain restored environment, got %v", envs)
+	}
+
+	var revisions []artefacts.Revision
+
+	if resp, err = http.Get(s.URL + "/history/users/userA/envA-1"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if err = json.NewDecoder(resp.Body).Decode(&revisions); err != nil {
+		t.Fatalf("unexpected error decoding response: %s", err)
+	} else if rev := revisions[0]; rev.Author != "softpack-frontend" {
+		t.Errorf("expecting restore to be authored by %q, got %q", "softpack-frontend", rev.Author)
+	} else if !strings.HasPrefix(rev.Message, "Restore users/userA/envA-1 from ") {
+		t.Errorf("expecting restore commit message, got %q", rev.Message)
+	}
+}
+
+func TestUserHeader(t *testing.T) {
+	_, s := newTestServer(t, apiFiles, UserHeader("X-Remote-User"), Admins("userC"))
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL+"/status/users/userA/envA-1", strings.NewReader("deprecated"))
+
+	req.SetBasicAuth("userB", "")
+	req.Header.Set("X-Remote-User", "userC")
+
+	if resp, err := http.DefaultClient.Do(req); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expecting status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	var revisions []artefacts.Revision
+
+	if resp, err := http.Get(s.URL + "/history/users/userA/envA-1"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if err = json.NewDecoder(resp.Body).Decode(&revisions); err != nil {
+		t.Fatalf("unexpected error decoding response: %s", err)
+	} else if rev := revisions[0]; rev.Author != "userC" {
+		t.Errorf("expecting change to be authored by %q, got %q", "userC", rev.Author)
+	}
+}
+
+func TestUnverified(t *testing.T) {
+	_, s := newTestServer(t, apiFiles, UserHeader("X-Remote-User"), Admins("admin"))
+
+	for n, test := range [...]struct {
+		User   string
+		Status int
+	}{
+		{Status: http.StatusForbidden},
+		{User: "userA", Status: http.StatusForbidden},
+		{User: "admin", Status: http.StatusOK},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, s.URL+"/admin/unverified", nil)
+
+		req.Header.Set("X-Remote-User", test.User)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		}
+
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != test.Status {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, test.Status, resp.StatusCode)
+		} else if test.Status == http.StatusOK && strings.TrimSpace(string(data)) != "[]" {
+			t.Errorf("test %d: expecting no unverified commits, got %s", n+1, data)
+		}
+	}
+}
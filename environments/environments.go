@@ -1,19 +1,23 @@
 package environments
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"path"
+	"runtime"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/gorilla/websocket"
 	"github.com/wtsi-hgi/softpack-frontend/artefacts"
+	"github.com/wtsi-hgi/softpack-frontend/compressed"
 	"gopkg.in/yaml.v3"
 )
 
@@ -23,82 +27,143 @@ const (
 	moduleFile              = "module"
 	readmeFile              = "README.md"
 	metaFile                = "meta.yml"
+	singularityFile         = "singularity.def"
 	builtBySoftpackFile     = ".built_by_softpack"
 	generatedFromModuleFile = ".generated_from_module"
 
 	socketPath        = "/socket"
+	snapshotPath      = "/snapshot"
 	uploadPath        = "/upload"
 	resendPendingPath = "/resend-pending-builds"
 )
 
-type envStatus byte
-
-const (
-	envBuilding envStatus = iota
-	envFailed
-	envReady
-)
-
 type descriptionPackages struct {
 	Description string
 	Packages    []string
 }
 
 type meta struct {
-	Tags []string
+	Tags   []string
+	Status *envStatus
+	Build  struct {
+		Host     string
+		Duration time.Duration
+	}
 }
 
+const (
+	ownerUser  = "user"
+	ownerGroup = "group"
+)
+
 type environment struct {
-	Tags        []string
-	Packages    []string
-	Description string
-	ReadMe      string
-	Status      envStatus
-	SoftPack    bool
+	OwnerKind     string
+	Owner         string
+	Name          string
+	Tags          []string
+	Packages      []string
+	Description   string
+	ReadMe        string
+	Status        envStatus
+	Transitions   []statusChange
+	SoftPack      bool
+	ModulePath    string  `json:",omitempty"`
+	BuildHost     string  `json:",omitempty"`
+	BuildDuration float64 `json:",omitempty"` // seconds
+	Created       time.Time
+	Updated       time.Time
+	Error         string `json:",omitempty"`
 }
 
 func environmentFromArtefacts(a artefacts.Environment) (*environment, error) {
-	e := &environment{
-		Tags: make([]string, 0),
+	names := make([]string, 0, len(a))
+
+	for name := range a {
+		names = append(names, name)
 	}
-	_, e.SoftPack = a[builtBySoftpackFile]
-	ef := a[environmentsFile]
 
-	if ef == nil {
-		return nil, ErrBadEnvironment
+	return environmentFromFiles(names, func(name string) (io.ReadCloser, error) {
+		return io.NopCloser(a[name]), nil
+	})
+}
+
+// environmentFromFiles parses an environment from the names of its files,
+// opening only those files whose contents are needed.
+//
+// If the environment cannot be parsed, the returned environment will be marked
+// as invalid, with the reason recorded in its Error field.
+func environmentFromFiles(names []string, open func(string) (io.ReadCloser, error)) (*environment, error) {
+	e := &environment{Status: envBuilding}
+
+	err := e.parse(names, open)
+	if err != nil {
+		e.Status = envInvalid
+		e.Error = err.Error()
 	}
 
-	if err := e.setSoftpackYaml(ef); err != nil {
-		return nil, err
+	// Clients expect lists, even for environments whose files could not be
+	// read.
+	if e.Tags == nil {
+		e.Tags = make([]string, 0)
 	}
 
-	if _, hasModule := a[moduleFile]; hasModule {
-		if err := parseReadyEnvironment(a, e); err != nil {
-			return nil, err
-		}
+	if e.Packages == nil {
+		e.Packages = make([]string, 0)
+	}
 
+	return e, err
+}
+
+func (e *environment) parse(names []string, open func(string) (io.ReadCloser, error)) error {
+	e.SoftPack = slices.Contains(names, builtBySoftpackFile)
+
+	if !slices.Contains(names, environmentsFile) {
+		return ErrMissingSoftpack
+	}
+
+	if err := readFile(open, environmentsFile, e.setSoftpackYaml); err != nil {
+		return err
+	}
+
+	if slices.Contains(names, moduleFile) {
 		e.Status = envReady
-	} else if _, hasbuilderOut := a[builderOut]; hasbuilderOut {
+
+		if err := e.parseReady(names, open); err != nil {
+			return err
+		}
+	} else if slices.Contains(names, builderOut) {
 		e.Status = envFailed
 	}
 
-	return e, nil
+	return nil
 }
 
-func parseReadyEnvironment(a artefacts.Environment, e *environment) error {
-	meta := a[metaFile]
-	readme := a[readmeFile]
+func readFile(open func(string) (io.ReadCloser, error), name string, fn func(io.Reader) error) error {
+	f, err := open(name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
 
-	if readme == nil {
-		return ErrBadEnvironment
+	defer f.Close()
+
+	if err = fn(f); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
 	}
 
-	if err := e.setReadme(readme); err != nil {
+	return nil
+}
+
+func (e *environment) parseReady(names []string, open func(string) (io.ReadCloser, error)) error {
+	if !slices.Contains(names, readmeFile) {
+		return ErrMissingReadme
+	}
+
+	if err := readFile(open, readmeFile, e.setReadme); err != nil {
 		return err
 	}
 
-	if meta != nil {
-		if err := e.setMeta(meta); err != nil {
+	if slices.Contains(names, metaFile) {
+		if err := readFile(open, metaFile, e.setMeta); err != nil {
 			return err
 		}
 	}
@@ -127,10 +192,25 @@ func (e *environment) setReadme(r io.Reader) error {
 	}
 
 	e.ReadMe = sb.String()
+	e.ModulePath = modulePathFromReadme(e.ReadMe)
 
 	return nil
 }
 
+// modulePathFromReadme finds the path passed to the first "module load"
+// command in the readme.
+func modulePathFromReadme(readme string) string {
+	for _, line := range strings.Split(readme, "\n") {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(line), "module load "); ok {
+			if fields := strings.Fields(rest); len(fields) > 0 {
+				return fields[0]
+			}
+		}
+	}
+
+	return ""
+}
+
 func (e *environment) setMeta(r io.Reader) error {
 	var metadata meta
 
@@ -140,86 +220,262 @@ func (e *environment) setMeta(r io.Reader) error {
 
 	e.Tags = metadata.Tags
 
+	if metadata.Status != nil && e.Status.canTransition(*metadata.Status) && *metadata.Status != envInvalid {
+		e.Status = *metadata.Status
+	}
+
+	e.BuildHost = metadata.Build.Host
+	e.BuildDuration = metadata.Build.Duration.Seconds()
+
 	return nil
 }
 
-func (e *environment) setStatus(s envStatus) {
-	e.Status = s
+func (e *environment) setLocation(p envLocation) {
+	e.OwnerKind = ownerUser
+
+	if p.usersOrGroups == artefacts.GroupDirectory {
+		e.OwnerKind = ownerGroup
+	}
+
+	e.Owner = p.owner
+	e.Name = p.name
+}
+
+func (e *environment) setTimes(t artefacts.Times) {
+	e.Created = t.Created
+	e.Updated = t.Updated
 }
 
 type environments map[string]*environment
 
-func (e environments) LoadFrom(a *artefacts.Artefacts, base string) error {
-	entries, err := a.List(base)
-	if errors.Is(err, object.ErrDirectoryNotFound) {
-		return nil
-	} else if err != nil {
+// loadWorkers is the maximum number of environments that will be read from
+// the artefacts concurrently when loading.
+var loadWorkers = 2 * runtime.GOMAXPROCS(0)
+
+type envLocation struct {
+	usersOrGroups, owner, name string
+}
+
+func (p envLocation) String() string {
+	return path.Join(p.usersOrGroups, p.owner, p.name)
+}
+
+// LoadFrom reads all of the environments in the given base directories,
+// reading multiple environments in parallel.
+//
+// Environments that cannot be parsed are logged and kept, marked as invalid.
+func (e environments) LoadFrom(a ArtefactStore, bases ...string) error {
+	start := time.Now()
+
+	paths, err := listEnvironments(a, bases)
+	if err != nil {
 		return err
 	}
 
-	for _, entry := range entries {
-		envs, err := a.List(base, entry)
-		if err != nil {
-			return err
-		}
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		stop     atomic.Bool
+		firstErr error
+		invalid  int
+		jobs     = make(chan envLocation)
+		times    = make(chan map[string]artefacts.Times, 1)
+	)
 
-		for _, env := range envs {
-			as, err := a.GetEnv(base, entry, env)
-			if err != nil {
-				return err
-			}
+	go func() { times <- environmentTimes(a) }()
 
-			p := path.Join(base, entry, env)
+	for range min(loadWorkers, len(paths)) {
+		wg.Add(1)
 
-			ep, err := environmentFromArtefacts(as)
-			if err != nil {
-				slog.Error("failed to load environment", "env", path.Join(base, entry, env), "err", err)
+		go func() {
+			defer wg.Done()
+
+			for p := range jobs {
+				if stop.Load() {
+					continue
+				}
+
+				names, err := a.List(p.usersOrGroups, p.owner, p.name)
+				if err != nil {
+					mu.Lock()
+
+					if firstErr == nil {
+						firstErr = err
+					}
+
+					mu.Unlock()
+					stop.Store(true)
+
+					continue
+				}
+
+				env, err := readEnvironment(a, p, names)
+				if err != nil {
+					slog.Warn("invalid environment", "env", p.String(), "err", err)
+				}
+
+				mu.Lock()
+
+				if err != nil {
+					invalid++
+				}
 
-				continue
+				e[p.String()] = env
+
+				mu.Unlock()
 			}
+		}()
+	}
+
+	for _, p := range paths {
+		jobs <- p
+	}
+
+	close(jobs)
+	wg.Wait()
 
-			e[p] = ep
+	if firstErr != nil {
+		return firstErr
+	}
+
+	for p, t := range <-times {
+		if env, ok := e[p]; ok {
+			env.setTimes(t)
 		}
 	}
 
+	for _, env := range e {
+		env.observeStatus(nil, env.Updated)
+	}
+
+	slog.Info("loaded environments", "count", len(paths), "invalid", invalid, "duration", time.Since(start))
+
 	return nil
 }
 
+// environmentTimes retrieves the creation and update times of the environments
+// from stores that keep a history.
+func environmentTimes(a ArtefactStore, paths ...string) map[string]artefacts.Times {
+	ts, ok := a.(timesStore)
+	if !ok {
+		return nil
+	}
+
+	times, err := ts.EnvironmentTimes(paths...)
+	if err != nil {
+		slog.Warn("failed to read environment times", "err", err)
+	}
+
+	return times
+}
+
+func listEnvironments(a ArtefactStore, bases []string) ([]envLocation, error) {
+	var paths []envLocation
+
+	for _, base := range bases {
+		entries, err := a.List(base)
+		if errors.Is(err, object.ErrDirectoryNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			envs, err := a.List(base, entry)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, env := range envs {
+				paths = append(paths, envLocation{usersOrGroups: base, owner: entry, name: env})
+			}
+		}
+	}
+
+	return paths, nil
+}
+
+// readEnvironment parses the environment at the given path from the names of
+// its files, only reading the files needed from the store.
+func readEnvironment(a ArtefactStore, p envLocation, names []string) (*environment, error) {
+	e, err := environmentFromFiles(names, func(name string) (io.ReadCloser, error) {
+		return a.GetFile(p.usersOrGroups, p.owner, p.name, name)
+	})
+
+	e.setLocation(p)
+
+	return e, err
+}
+
 type Environments struct {
-	artefacts *artefacts.Artefacts
+	artefacts ArtefactStore
 	socket
 	http.ServeMux
 
 	mu           sync.RWMutex
+	statusMu     sync.Mutex
 	environments map[string]*environment
-	json         json.RawMessage
+	snapshot     *compressed.Snapshot
+	userHeader   string
+	admins       []string
+	builderToken []byte
 }
 
-func New(a *artefacts.Artefacts) (*Environments, error) {
-	envs := make(environments)
+func New(a ArtefactStore, opts ...Option) (*Environments, error) {
+	var o options
 
-	if err := envs.LoadFrom(a, artefacts.UserDirectory); err != nil {
-		return nil, err
+	for _, opt := range opts {
+		opt(&o)
 	}
 
-	if err := envs.LoadFrom(a, artefacts.GroupDirectory); err != nil {
+	envs := make(environments)
+
+	if err := envs.LoadFrom(a, artefacts.UserDirectory, artefacts.GroupDirectory); err != nil {
 		return nil, err
 	}
 
 	e := &Environments{
 		artefacts:    a,
 		environments: envs,
+		snapshot:     compressed.NewSnapshot("environments.json"),
+		userHeader:   o.userHeader,
+		admins:       o.admins,
+		builderToken: []byte(o.builderToken),
 	}
 
 	e.socket.Environments = e
-	e.socket.conns = make(map[*websocket.Conn]struct{})
+	e.socket.conns = make(map[*conn]struct{})
+	e.socket.logs.maxLength = maxLogLength
 
 	e.ServeMux.HandleFunc(socketPath, e.handleSocket)
 	e.ServeMux.HandleFunc(uploadPath, e.handleUpload)
 	e.ServeMux.HandleFunc(resendPendingPath, e.handleResend)
+	e.ServeMux.Handle(snapshotPath, e.snapshot)
+	e.ServeMux.HandleFunc(listPath, e.handleList)
+	e.ServeMux.HandleFunc(envPath, e.handleEnvironment)
+	e.ServeMux.HandleFunc(filePath, e.handleFile)
+	e.ServeMux.HandleFunc(historyPath, e.handleHistory)
+	e.ServeMux.HandleFunc(revisionPath, e.handleRevision)
+	e.ServeMux.HandleFunc(diffPath, e.handleDiff)
+	e.ServeMux.HandleFunc(deletedPath, e.handleDeleted)
+	e.ServeMux.HandleFunc(restorePath, e.handleRestore)
+	e.ServeMux.HandleFunc(invalidPath, e.handleInvalid)
+	e.ServeMux.HandleFunc(unverifiedPath, e.handleUnverified)
+	e.ServeMux.HandleFunc(statusPath, e.handleSetStatus)
+	e.ServeMux.HandleFunc(logPath, e.handleLog)
+	e.ServeMux.HandleFunc(treePath, e.handleTree)
 
 	e.updateJSON()
 
+	updates, _ := e.snapshot.Subscribe()
+
+	go e.broadcastUpdates(updates)
+	go e.logs.expireEvery(logExpiry)
+
+	changes, _ := a.Watch()
+
+	go e.watchArtefacts(changes)
+
 	return e, nil
 }
 
@@ -240,15 +496,79 @@ func (e *Environments) handleUpload(w http.ResponseWriter, r *http.Request) {}
 
 func (e *Environments) handleResend(w http.ResponseWriter, r *http.Request) {}
 
-func (e *Environments) updateJSON() {
+func (e *Environments) loadEnvironment(usersOrGroups, owner, name string) (*environment, error) {
+	names, err := e.artefacts.List(usersOrGroups, owner, name)
+	if err != nil {
+		return nil, err
+	}
+
+	p := envLocation{usersOrGroups: usersOrGroups, owner: owner, name: name}
+
+	env, err := readEnvironment(e.artefacts, p, names)
+
+	if t, ok := environmentTimes(e.artefacts, p.String())[p.String()]; ok {
+		env.setTimes(t)
+	}
+
+	return env, err
+}
+
+// setEnvironment stores a newly read environment, carrying over the status
+// history of any previous version.
+func (e *Environments) setEnvironment(p string, env *environment) {
 	e.mu.Lock()
-	defer e.mu.Unlock()
+	env.observeStatus(e.environments[p], time.Now())
+	e.environments[p] = env
+	e.mu.Unlock()
 
-	var buf bytes.Buffer
+	e.updateJSON()
+}
 
-	json.NewEncoder(&buf).Encode(e.environments)
+func (e *Environments) removeEnvironment(p string) {
+	e.mu.Lock()
+	delete(e.environments, p)
+	e.mu.Unlock()
 
-	e.json = json.RawMessage(buf.Bytes())
+	e.updateJSON()
+}
+
+func (e *Environments) watchArtefacts(changes <-chan string) {
+	for p := range changes {
+		parts := strings.SplitN(p, "/", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		env, err := e.loadEnvironment(parts[0], parts[1], parts[2])
+		if errors.Is(err, object.ErrDirectoryNotFound) {
+			e.removeEnvironment(p)
+
+			continue
+		} else if err != nil {
+			slog.Warn("invalid environment", "env", p, "err", err)
+		}
+
+		if env != nil {
+			e.setEnvironment(p, env)
+		}
+	}
+}
+
+func (e *Environments) updateJSON() {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	e.snapshot.Encode(e.environments)
 }
 
-var ErrBadEnvironment = errors.New("bad environment")
+func (e *Environments) broadcastUpdates(updates <-chan compressed.Update) {
+	for update := range updates {
+		e.socket.SendToAll(update)
+	}
+}
+
+var (
+	ErrBadEnvironment  = errors.New("bad environment")
+	ErrMissingSoftpack = fmt.Errorf("%w: missing %s", ErrBadEnvironment, environmentsFile)
+	ErrMissingReadme   = fmt.Errorf("%w: module without %s", ErrBadEnvironment, readmeFile)
+)
@@ -2,6 +2,7 @@ package environments
 
 import (
 	"encoding/json"
+	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"testing"
@@ -33,11 +34,15 @@ packages:
 			},
 			Expectation: environments{
 				"users/userA/envA-1": {
+					OwnerKind:   ownerUser,
+					Owner:       "userA",
+					Name:        "envA-1",
 					Tags:        []string{},
 					Packages:    []string{"packageA@1", "packageB@2"},
 					Description: "MY DESC",
 					ReadMe:      "README",
 					Status:      envReady,
+					Transitions: []statusChange{{Status: envReady}},
 					SoftPack:    true,
 				},
 			},
@@ -52,12 +57,26 @@ packages:
 			t.Fatalf("test %d: unexpected error creating environments: %s", n+1, err)
 		} else if envs, err := loadFromWebsocket("ws" + httptest.NewServer(e).URL[4:] + socketPath); err != nil {
 			t.Fatalf("test %d: unexpected error getting environments: %s", n+1, err)
-		} else if !reflect.DeepEqual(envs, test.Expectation) {
+		} else if clearTimes(envs); !reflect.DeepEqual(envs, test.Expectation) {
 			t.Errorf("test %d: expecting envs %#v, got %#v", n+1, test.Expectation, envs)
 		}
 	}
 }
 
+func clearTimes(envs environments) {
+	for _, env := range envs {
+		clearEnvTimes(env)
+	}
+}
+
+func clearEnvTimes(env *environment) {
+	env.Created, env.Updated = time.Time{}, time.Time{}
+
+	for n := range env.Transitions {
+		env.Transitions[n].Time = time.Time{}
+	}
+}
+
 func loadFromWebsocket(url string) (environments, error) {
 	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
 	if err != nil {
@@ -82,7 +101,7 @@ func loadFromWebsocket(url string) (environments, error) {
 			return
 		}
 
-		if err = json.Unmarshal(resp.Result, &envs); err != nil {
+		if _, envs, err = decodeSnapshot(resp); err != nil {
 			close(envsCh)
 
 			return
@@ -93,3 +112,84 @@ func loadFromWebsocket(url string) (environments, error) {
 
 	return <-envsCh, err
 }
+
+func TestSnapshot(t *testing.T) {
+	g := git.New(t)
+	g.Add(t, map[string]string{
+		artefacts.Environments + "/users/userA/envA-1/" + environmentsFile: "description: A\npackages:\n - packageA\n",
+	})
+
+	a, err := artefacts.New(artefacts.Remote(g.URL()))
+	if err != nil {
+		t.Fatalf("unexpected error creating artefacts: %s", err)
+	}
+
+	e, err := New(a)
+	if err != nil {
+		t.Fatalf("unexpected error creating environments: %s", err)
+	}
+
+	s := httptest.NewServer(e)
+
+	resp, err := http.Get(s.URL + snapshotPath)
+	if err != nil {
+		t.Fatalf("unexpected error getting snapshot: %s", err)
+	}
+
+	var envs environments
+
+	if err = json.NewDecoder(resp.Body).Decode(&envs); err != nil {
+		t.Fatalf("unexpected error decoding snapshot: %s", err)
+	} else if _, ok := envs["users/userA/envA-1"]; !ok || len(envs) != 1 {
+		t.Errorf("expecting snapshot to contain 1 environment, got %v", envs)
+	} else if resp.Header.Get("ETag") == "" {
+		t.Error("expecting snapshot to have an ETag")
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+s.URL[4:]+socketPath, nil)
+	if err != nil {
+		t.Fatalf("unexpected error connecting to websocket: %s", err)
+	}
+
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	var r response
+
+	if err = conn.ReadJSON(&r); err != nil {
+		t.Fatalf("unexpected error reading from websocket: %s", err)
+	}
+
+	first, _, err := decodeSnapshot(r)
+	if err != nil {
+		t.Fatalf("unexpected error decoding snapshot: %s", err)
+	}
+
+	e.mu.Lock()
+	e.environments["users/userA/envA-2"] = &environment{Tags: []string{}, Description: "B"}
+	e.mu.Unlock()
+
+	e.updateJSON()
+
+	if err = conn.ReadJSON(&r); err != nil {
+		t.Fatalf("unexpected error reading from websocket: %s", err)
+	} else if version, envs, err := decodeSnapshot(r); err != nil {
+		t.Fatalf("unexpected error decoding update: %s", err)
+	} else if env, ok := envs["users/userA/envA-2"]; !ok || env.Description != "B" {
+		t.Errorf("expecting update to contain new environment, got %v", envs)
+	} else if version <= first {
+		t.Errorf("expecting update version to be greater than %d, got %d", first, version)
+	}
+}
+
+func decodeSnapshot(r response) (uint64, environments, error) {
+	var snapshot struct {
+		Version      uint64
+		Environments environments
+	}
+
+	err := json.Unmarshal(r.Result, &snapshot)
+
+	return snapshot.Version, snapshot.Environments, err
+}
@@ -0,0 +1,187 @@
+package environments
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	logBroadcastID = -2
+	maxLogLength   = 16 << 20
+	logExpiry      = time.Hour
+)
+
+// logChunk is sent to subscribers of a build log for each piece of log pushed
+// by the builder.
+type logChunk struct {
+	Path  string
+	Chunk string
+	Final bool `json:",omitempty"`
+}
+
+type buildLog struct {
+	data      []byte
+	truncated bool
+	updated   time.Time
+}
+
+// contents returns the log, beginning with a notice when earlier parts of it
+// have been discarded.
+func (l *buildLog) contents() []byte {
+	if !l.truncated {
+		return l.data[:len(l.data):len(l.data)]
+	}
+
+	notice := fmt.Sprintf("[log truncated to last %d bytes]\n", len(l.data))
+
+	return append([]byte(notice), l.data...)
+}
+
+// buildLogs holds the logs of builds in progress, and the websocket
+// connections following them.
+//
+// Sending to a connection only adds to its queue, never blocking, so sends
+// happen with the lock held to ensure that a new subscriber receives the log so
+// far before any chunk pushed after it, and that chunks are received in order.
+//
+// Each log is limited to its last maxLength bytes, with a notice added to the
+// start of any log that has been cut short, and logs that have not been
+// added to for longer than the expiry age are discarded.
+type buildLogs struct {
+	mu          sync.Mutex
+	maxLength   int
+	logs        map[string]*buildLog
+	subscribers map[string]map[*conn]struct{}
+}
+
+func (b *buildLogs) subscribe(p string, c *conn, fn func([]byte)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscribers == nil {
+		b.subscribers = make(map[string]map[*conn]struct{})
+	}
+
+	subs, ok := b.subscribers[p]
+	if !ok {
+		subs = make(map[*conn]struct{})
+		b.subscribers[p] = subs
+	}
+
+	subs[c] = struct{}{}
+
+	var log []byte
+
+	if l, ok := b.logs[p]; ok {
+		log = l.contents()
+	}
+
+	fn(log)
+}
+
+func (b *buildLogs) unsubscribe(p string, c *conn) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.remove(p, c)
+}
+
+func (b *buildLogs) unsubscribeAll(c *conn) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for p := range b.subscribers {
+		b.remove(p, c)
+	}
+}
+
+func (b *buildLogs) remove(p string, c *conn) {
+	subs := b.subscribers[p]
+
+	delete(subs, c)
+
+	if len(subs) == 0 {
+		delete(b.subscribers, p)
+	}
+}
+
+// append adds a chunk to the log of the build at the given path, sending it on
+// to any subscribers, and returns the whole log so far.
+func (b *buildLogs) append(p string, chunk []byte) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.logs == nil {
+		b.logs = make(map[string]*buildLog)
+	}
+
+	l, ok := b.logs[p]
+	if !ok {
+		l = new(buildLog)
+		b.logs[p] = l
+	}
+
+	l.data = append(l.data, chunk...)
+	l.updated = time.Now()
+
+	if b.maxLength > 0 && len(l.data) > b.maxLength {
+		l.data = append([]byte(nil), l.data[len(l.data)-b.maxLength:]...)
+		l.truncated = true
+	}
+
+	if len(chunk) > 0 {
+		b.send(logChunk{Path: p, Chunk: string(chunk)})
+	}
+
+	return l.contents()
+}
+
+// finish discards the log of the build at the given path, telling any
+// subscribers that it is complete.
+func (b *buildLogs) finish(p string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.logs, p)
+
+	b.send(logChunk{Path: p, Final: true})
+}
+
+// expire discards the logs last added to before the given time, as their
+// builds are assumed to have been abandoned.
+func (b *buildLogs) expire(before time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for p, l := range b.logs {
+		if l.updated.Before(before) {
+			delete(b.logs, p)
+
+			b.send(logChunk{Path: p, Final: true})
+		}
+	}
+}
+
+func (b *buildLogs) expireEvery(age time.Duration) {
+	ticker := time.NewTicker(age / 2)
+
+	for range ticker.C {
+		b.expire(time.Now().Add(-age))
+	}
+}
+
+func (b *buildLogs) send(chunk logChunk) {
+	if len(b.subscribers[chunk.Path]) == 0 {
+		return
+	}
+
+	data := encodeMessage(logBroadcastID, chunk)
+
+	for c := range b.subscribers[chunk.Path] {
+		c.send(data)
+	}
+}
+
+var ErrBuildResultMissing = errors.New("final log of a successful build stored before its module")
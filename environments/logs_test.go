@@ -0,0 +1,208 @@
+package environments
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestBuildLog(t *testing.T) {
+	e, s := newTestServer(t, apiFiles, BuilderToken("secret"))
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+s.URL[4:]+socketPath, nil)
+	if err != nil {
+		t.Fatalf("unexpected error connecting to websocket: %s", err)
+	}
+
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	readMessage := func() response {
+		t.Helper()
+
+		for {
+			var r response
+
+			if err := conn.ReadJSON(&r); err != nil {
+				t.Fatalf("unexpected error reading from websocket: %s", err)
+			} else if r.ID != -1 {
+				return r
+			}
+		}
+	}
+
+	pushLogWithToken := func(p, chunk, token string) int {
+		t.Helper()
+
+		req, _ := http.NewRequest(http.MethodPost, s.URL+"/log/"+p, strings.NewReader(chunk))
+
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	pushLog := func(p, chunk string) int {
+		t.Helper()
+
+		return pushLogWithToken(p, chunk, "secret")
+	}
+
+	for n, token := range [...]string{"", "wrong", "secret2"} {
+		if status := pushLogWithToken("users/userA/envA-1?final", "forged\n", token); status != http.StatusUnauthorized {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, http.StatusUnauthorized, status)
+		}
+	}
+
+	for n, test := range [...]struct {
+		Path   string
+		Chunk  string
+		Status int
+	}{
+		{Path: "users/userA/envA-1", Chunk: "first\n", Status: http.StatusOK},
+		{Path: "users/userA/envA-2", Chunk: "first\n", Status: http.StatusNotFound},
+		{Path: "other/userA/envA-1", Chunk: "first\n", Status: http.StatusNotFound},
+		{Path: "users/userA/envA-1", Chunk: strings.Repeat("a", maxLogChunkLength+1), Status: http.StatusRequestEntityTooLarge},
+	} {
+		if status := pushLog(test.Path, test.Chunk); status != test.Status {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, test.Status, status)
+		}
+	}
+
+	conn.WriteJSON(request{ID: 1, Method: "unknown"})
+
+	if r := readMessage(); r.ID != 1 || r.Error == nil || r.Error.Code != errCodeUnknownMethod {
+		t.Errorf("expecting unknown method error, got %v", r)
+	}
+
+	conn.WriteJSON(request{ID: 2, Method: "subscribeLog", Params: json.RawMessage(`"users/userA/envA-1"`)})
+
+	var log string
+
+	if r := readMessage(); r.ID != 2 {
+		t.Fatalf("expecting response to subscribe request, got %v", r)
+	} else if err = json.Unmarshal(r.Result, &log); err != nil {
+		t.Fatalf("unexpected error decoding log: %s", err)
+	} else if log != "first\n" {
+		t.Errorf("expecting log %q, got %q", "first\n", log)
+	}
+
+	pushLog("users/userA/envA-1", "second\n")
+
+	if status := pushLog("users/userA/envA-1?final", "third\n"); status != http.StatusOK {
+		t.Fatalf("expecting status %d, got %d", http.StatusOK, status)
+	}
+
+	for n, expected := range [...]logChunk{
+		{Path: "users/userA/envA-1", Chunk: "second\n"},
+		{Path: "users/userA/envA-1", Chunk: "third\n"},
+		{Path: "users/userA/envA-1", Final: true},
+	} {
+		var chunk logChunk
+
+		if r := readMessage(); r.ID != logBroadcastID {
+			t.Fatalf("test %d: expecting log chunk, got %v", n+1, r)
+		} else if err = json.Unmarshal(r.Result, &chunk); err != nil {
+			t.Fatalf("test %d: unexpected error decoding chunk: %s", n+1, err)
+		} else if !reflect.DeepEqual(chunk, expected) {
+			t.Errorf("test %d: expecting chunk %v, got %v", n+1, expected, chunk)
+		}
+	}
+
+	resp, err := http.Get(s.URL + "/environment/users/userA/envA-1/" + builderOut)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	defer resp.Body.Close()
+
+	if data, _ := io.ReadAll(resp.Body); string(data) != "first\nsecond\nthird\n" {
+		t.Errorf("expecting stored log %q, got %q", "first\nsecond\nthird\n", data)
+	}
+
+	for n, test := range [...]struct {
+		Path   string
+		Status int
+	}{
+		{Path: "groups/groupC/envC-1?final", Status: http.StatusConflict},
+		{Path: "groups/groupC/envC-1?final=ready", Status: http.StatusConflict},
+		{Path: "groups/groupC/envC-1?final=failed", Status: http.StatusOK},
+	} {
+		if status := pushLog(test.Path, "log\n"); status != test.Status {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, test.Status, status)
+		}
+	}
+
+	waitFor(t, func() bool {
+		return getEnvironment(e, "groups/groupC/envC-1").Status == envFailed
+	})
+
+	conn.WriteJSON(request{ID: 3, Method: "unsubscribeLog", Params: json.RawMessage(`"users/userA/envA-1"`)})
+
+	if r := readMessage(); r.ID != 3 || r.Error != nil {
+		t.Errorf("expecting response to unsubscribe request, got %v", r)
+	}
+
+	pushLog("users/userA/envA-1", "ignored\n")
+	conn.WriteJSON(request{ID: 4, Method: "subscribeLog", Params: json.RawMessage(`"users/userA/envA-1"`)})
+
+	if r := readMessage(); r.ID != 4 || string(r.Result) != `"ignored\n"` {
+		t.Errorf("expecting only a response to the new subscription, got %v", r)
+	}
+}
+
+func TestBuildLogDisabled(t *testing.T) {
+	_, s := newTestServer(t, apiFiles)
+
+	req, _ := http.NewRequest(http.MethodPost, s.URL+"/log/users/userA/envA-1", strings.NewReader("log"))
+
+	req.Header.Set("Authorization", "Bearer ")
+
+	if resp, err := http.DefaultClient.Do(req); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expecting status %d, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func TestBuildLogLimits(t *testing.T) {
+	b := buildLogs{maxLength: 8}
+
+	for n, test := range [...]struct {
+		Chunk, Expectation string
+	}{
+		{Chunk: "abc", Expectation: "abc"},
+		{Chunk: "defg", Expectation: "abcdefg"},
+		{Chunk: "hijk", Expectation: "[log truncated to last 8 bytes]\ndefghijk"},
+		{Chunk: "0123456789", Expectation: "[log truncated to last 8 bytes]\n23456789"},
+	} {
+		if log := b.append("users/userA/envA-1", []byte(test.Chunk)); string(log) != test.Expectation {
+			t.Errorf("test %d: expecting log %q, got %q", n+1, test.Expectation, log)
+		}
+	}
+
+	b.append("users/userB/envB-1", []byte("log"))
+	b.logs["users/userA/envA-1"].updated = time.Now().Add(-2 * logExpiry)
+	b.expire(time.Now().Add(-logExpiry))
+
+	if _, ok := b.logs["users/userA/envA-1"]; ok {
+		t.Errorf("expecting stale log to be expired")
+	} else if _, ok = b.logs["users/userB/envB-1"]; !ok {
+		t.Errorf("expecting recent log to be kept")
+	}
+}
@@ -0,0 +1,40 @@
+package environments
+
+type Option func(*options)
+
+type options struct {
+	userHeader   string
+	admins       []string
+	builderToken string
+}
+
+// UserHeader sets the request header from which the user responsible for a
+// change is taken.
+//
+// The header must be set by an authenticating reverse proxy, which should also
+// strip it from any incoming request. Without it, changes are attributed to the
+// committer of the artefacts repository.
+func UserHeader(header string) Option {
+	return func(o *options) {
+		o.userHeader = header
+	}
+}
+
+// Admins sets the users, as identified by the UserHeader, allowed to use the
+// admin endpoints.
+//
+// Without a UserHeader no user can be identified, so the admin endpoints are
+// unavailable.
+func Admins(users ...string) Option {
+	return func(o *options) {
+		o.admins = users
+	}
+}
+
+// BuilderToken enables the endpoint to which builders push their logs, which
+// will only accept requests bearing the given token.
+func BuilderToken(token string) Option {
+	return func(o *options) {
+		o.builderToken = token
+	}
+}
@@ -5,16 +5,105 @@ import (
 	"encoding/json"
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/wtsi-hgi/softpack-frontend/compressed"
 	"vimagination.zapto.org/jsonrpc"
 )
 
+const (
+	socketWriteTimeout = 10 * time.Second
+	socketQueueLength  = 64
+
+	errCodeUnknownMethod = -32601
+	errCodeInvalidParams = -32602
+)
+
 type socket struct {
 	*Environments
 
 	mu    sync.RWMutex
-	conns map[*websocket.Conn]struct{}
+	conns map[*conn]struct{}
+	logs  buildLogs
+}
+
+// conn queues messages for a websocket connection, writing them in order from
+// a single goroutine.
+//
+// A connection that falls too far behind is closed rather than allowed to hold
+// up the senders.
+type conn struct {
+	*websocket.Conn
+
+	queue     chan json.RawMessage
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newConn(wsConn *websocket.Conn) *conn {
+	c := &conn{
+		Conn:  wsConn,
+		queue: make(chan json.RawMessage, socketQueueLength),
+		done:  make(chan struct{}),
+	}
+
+	go c.writeLoop()
+
+	return c
+}
+
+func (c *conn) writeLoop() {
+	for {
+		select {
+		case data := <-c.queue:
+			c.SetWriteDeadline(time.Now().Add(socketWriteTimeout)) //nolint:errcheck
+
+			if err := c.WriteMessage(websocket.TextMessage, data); err != nil {
+				c.close()
+
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *conn) send(data json.RawMessage) {
+	select {
+	case <-c.done:
+	case c.queue <- data:
+	default:
+		c.close()
+	}
+}
+
+func (c *conn) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.Conn.Close()
+	})
+}
+
+func (c *conn) respond(id int, result any, err error) {
+	resp := response{ID: id}
+
+	if err != nil {
+		code := errCodeInvalidParams
+
+		if errors.Is(err, ErrUnknownEndpoint) {
+			code = errCodeUnknownMethod
+		}
+
+		resp.Error = &jsonError{Code: code, Message: err.Error()}
+	} else if resp.Result, err = json.Marshal(result); err != nil {
+		resp.Error = &jsonError{Code: errCodeInvalidParams, Message: err.Error()}
+	}
+
+	data, _ := json.Marshal(resp)
+
+	c.send(data)
 }
 
 type jsonError struct {
@@ -30,54 +119,98 @@ type response struct {
 }
 
 type request struct {
-	ID     int    `json:"id"`
-	Method string `json:"method"`
-	Params any    `json:"params,omitempty"`
+	ID     int             `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
 }
 
-func (s *socket) ServeConn(conn *websocket.Conn) {
-	s.Environments.mu.RLock()
-	toSend := encodeBroadcast(s.json)
-	s.Environments.mu.RUnlock()
+// snapshotMessage is broadcast with every change to the environments, the
+// version allowing clients to ignore any update older than one already seen.
+type snapshotMessage struct {
+	Version      uint64
+	Environments json.RawMessage
+}
 
-	conn.WriteJSON(toSend)
+func (s *socket) ServeConn(wsConn *websocket.Conn) {
+	c := newConn(wsConn)
 
 	s.mu.Lock()
-	s.conns[conn] = struct{}{}
+	s.conns[c] = struct{}{}
+	c.send(encodeBroadcast(s.snapshot.Current()))
 	s.mu.Unlock()
 
 	for {
 		var request request
 
-		if err := conn.ReadJSON(&request); err != nil {
+		if err := c.ReadJSON(&request); err != nil {
 			break
 		}
 
-		// handle request
+		s.handleRequest(c, request)
 	}
 
 	s.mu.Lock()
-	delete(s.conns, conn)
+	delete(s.conns, c)
 	s.mu.Unlock()
+
+	s.logs.unsubscribeAll(c)
+	c.close()
+}
+
+func (s *socket) handleRequest(c *conn, req request) {
+	switch req.Method {
+	case "subscribeLog":
+		var p string
+
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			c.respond(req.ID, nil, err)
+
+			return
+		}
+
+		s.logs.subscribe(p, c, func(log []byte) {
+			c.respond(req.ID, string(log), nil)
+		})
+	case "unsubscribeLog":
+		var p string
+
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			c.respond(req.ID, nil, err)
+
+			return
+		}
+
+		s.logs.unsubscribe(p, c)
+		c.respond(req.ID, nil, nil)
+	default:
+		c.respond(req.ID, nil, ErrUnknownEndpoint)
+	}
+}
+
+func encodeBroadcast(update compressed.Update) json.RawMessage {
+	return encodeMessage(-1, snapshotMessage{
+		Version:      update.Version,
+		Environments: json.RawMessage(update.Data),
+	})
 }
 
-func encodeBroadcast(data any) json.RawMessage {
+func encodeMessage(id int, data any) json.RawMessage {
 	var buf bytes.Buffer
 
 	json.NewEncoder(&buf).Encode(jsonrpc.Response{
-		ID:     -1,
+		ID:     id,
 		Result: data,
 	})
 
 	return json.RawMessage(buf.Bytes())
 }
 
-func (s *socket) SendToAll(data any) {
-	toSend := encodeBroadcast(data)
+func (s *socket) SendToAll(update compressed.Update) {
+	toSend := encodeBroadcast(update)
 
 	s.mu.RLock()
-	for conn := range s.conns {
-		go conn.WriteJSON(toSend)
+	for c := range s.conns {
+		c.send(toSend)
 	}
 	s.mu.RUnlock()
 }
@@ -0,0 +1,122 @@
+package environments
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+type envStatus byte
+
+const (
+	envQueued envStatus = iota
+	envBuilding
+	envFailed
+	envReady
+	envDeprecated
+	envArchived
+	envInvalid
+)
+
+var statusNames = [...]string{ //nolint:gochecknoglobals
+	envQueued:     "queued",
+	envBuilding:   "building",
+	envFailed:     "failed",
+	envReady:      "ready",
+	envDeprecated: "deprecated",
+	envArchived:   "archived",
+	envInvalid:    "invalid",
+}
+
+// statusTransitions lists the states that each state can move to.
+//
+// Any state may become invalid, and an invalid environment may move to any
+// state once fixed, so invalid is handled separately.
+var statusTransitions = map[envStatus][]envStatus{ //nolint:gochecknoglobals
+	envQueued:     {envBuilding, envFailed},
+	envBuilding:   {envFailed, envReady},
+	envFailed:     {envQueued, envBuilding},
+	envReady:      {envQueued, envBuilding, envDeprecated, envArchived},
+	envDeprecated: {envReady, envArchived},
+	envArchived:   {envReady},
+}
+
+func (s envStatus) String() string {
+	if int(s) < len(statusNames) {
+		return statusNames[s]
+	}
+
+	return "unknown"
+}
+
+func (s envStatus) MarshalText() ([]byte, error) {
+	if int(s) >= len(statusNames) {
+		return nil, ErrUnknownStatus
+	}
+
+	return []byte(statusNames[s]), nil
+}
+
+func (s *envStatus) UnmarshalText(text []byte) error {
+	pos := slices.Index(statusNames[:], string(text))
+	if pos < 0 {
+		return ErrUnknownStatus
+	}
+
+	*s = envStatus(pos)
+
+	return nil
+}
+
+func (s envStatus) canTransition(to envStatus) bool {
+	return s == envInvalid || to == envInvalid || slices.Contains(statusTransitions[s], to)
+}
+
+type statusChange struct {
+	Status envStatus
+	Time   time.Time
+}
+
+// setStatus moves the environment to the given status, recording the time of
+// the transition.
+//
+// Returns ErrInvalidTransition if the state machine does not allow the change.
+func (e *environment) setStatus(s envStatus, at time.Time) error {
+	if s == e.Status {
+		return nil
+	}
+
+	if !e.Status.canTransition(s) {
+		return ErrInvalidTransition
+	}
+
+	e.Status = s
+	e.Transitions = append(e.Transitions, statusChange{Status: s, Time: at})
+
+	return nil
+}
+
+// observeStatus carries over the transitions of the previous version of an
+// environment, recording a change in status as read from the artefacts.
+//
+// As the artefacts are the source of truth, observed changes are recorded even
+// when they skip states.
+func (e *environment) observeStatus(prev *environment, at time.Time) {
+	if prev == nil {
+		e.Transitions = []statusChange{{Status: e.Status, Time: at}}
+
+		return
+	}
+
+	e.Transitions = slices.Clip(prev.Transitions)
+
+	if prev.Status != e.Status {
+		e.Transitions = append(e.Transitions, statusChange{Status: e.Status, Time: at})
+	}
+}
+
+var (
+	ErrUnknownStatus     = errors.New("unknown status")
+	ErrInvalidTransition = errors.New("invalid status transition")
+	ErrStatusNotSettable = errors.New("status cannot be set directly")
+)
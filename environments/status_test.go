@@ -0,0 +1,156 @@
+package environments
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wtsi-hgi/softpack-frontend/artefacts"
+)
+
+func TestStatusJSON(t *testing.T) {
+	for n, status := range statusNames {
+		data, err := json.Marshal(envStatus(n))
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		} else if expected := `"` + status + `"`; string(data) != expected {
+			t.Errorf("test %d: expecting %s, got %s", n+1, expected, data)
+		}
+
+		var s envStatus
+
+		if err = json.Unmarshal(data, &s); err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		} else if s != envStatus(n) {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, n, s)
+		}
+	}
+
+	var s envStatus
+
+	if err := json.Unmarshal([]byte(`"unknown"`), &s); !errors.Is(err, ErrUnknownStatus) {
+		t.Errorf("expecting error %q, got %q", ErrUnknownStatus, err)
+	}
+}
+
+func TestSetStatus(t *testing.T) {
+	for n, test := range [...]struct {
+		From, To envStatus
+		Valid    bool
+	}{
+		{From: envQueued, To: envBuilding, Valid: true},
+		{From: envQueued, To: envReady},
+		{From: envBuilding, To: envReady, Valid: true},
+		{From: envBuilding, To: envQueued},
+		{From: envFailed, To: envQueued, Valid: true},
+		{From: envReady, To: envDeprecated, Valid: true},
+		{From: envReady, To: envFailed},
+		{From: envDeprecated, To: envArchived, Valid: true},
+		{From: envArchived, To: envDeprecated},
+		{From: envArchived, To: envInvalid, Valid: true},
+		{From: envInvalid, To: envReady, Valid: true},
+	} {
+		at := time.Now()
+		env := environment{Status: test.From}
+
+		if err := env.setStatus(test.To, at); test.Valid && err != nil {
+			t.Errorf("test %d: unexpected error: %s", n+1, err)
+		} else if !test.Valid && !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("test %d: expecting error %q, got %q", n+1, ErrInvalidTransition, err)
+		} else if test.Valid && (env.Status != test.To || len(env.Transitions) != 1 || env.Transitions[0] != (statusChange{Status: test.To, Time: at})) {
+			t.Errorf("test %d: expecting transition to %s, got %s with %v", n+1, test.To, env.Status, env.Transitions)
+		} else if !test.Valid && (env.Status != test.From || len(env.Transitions) != 0) {
+			t.Errorf("test %d: expecting status to remain %s, got %s with %v", n+1, test.From, env.Status, env.Transitions)
+		}
+	}
+}
+
+func TestHandleSetStatus(t *testing.T) {
+	store := newFakeStore(map[string]map[string]string{
+		"users/userA/envA-1": {
+			environmentsFile: "description: A\npackages:\n - packageA\n",
+			moduleFile:       "",
+			readmeFile:       "README",
+			metaFile:         "tags:\n - tagA\n",
+		},
+		"users/userB/envB-1": {environmentsFile: "description: B\npackages:\n - packageB\n"},
+	})
+
+	e, err := New(store, UserHeader("X-Remote-User"), Admins("admin"))
+	if err != nil {
+		t.Fatalf("unexpected error creating environments: %s", err)
+	}
+
+	for n, user := range [...]string{"", "userA"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/status/users/userA/envA-1", strings.NewReader("archived"))
+
+		r.Header.Set("X-Remote-User", user)
+		r.SetBasicAuth("admin", "")
+		e.ServeHTTP(w, r)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("test %d: expecting status code %d, got %d", n+1, http.StatusForbidden, w.Code)
+		} else if env := getEnvironment(e, "users/userA/envA-1"); env.Status != envReady {
+			t.Errorf("test %d: expecting status to be unchanged, got %s", n+1, env.Status)
+		}
+	}
+
+	for n, test := range [...]struct {
+		Path, Status string
+		Code         int
+		Expectation  envStatus
+	}{
+		{Path: "users/userA/envA-1", Status: "deprecated", Code: http.StatusOK, Expectation: envDeprecated},
+		{Path: "users/userA/envA-1", Status: "building", Code: http.StatusBadRequest, Expectation: envDeprecated},
+		{Path: "users/userA/envA-1", Status: "unknown", Code: http.StatusBadRequest, Expectation: envDeprecated},
+		{Path: "users/userA/envA-1", Status: "archived", Code: http.StatusOK, Expectation: envArchived},
+		{Path: "users/userA/envA-1", Status: "deprecated", Code: http.StatusConflict, Expectation: envArchived},
+		{Path: "users/userB/envB-1", Status: "archived", Code: http.StatusConflict, Expectation: envBuilding},
+		{Path: "users/userC/envC-1", Status: "ready", Code: http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+
+		r := httptest.NewRequest(http.MethodPost, "/status/"+test.Path, strings.NewReader(test.Status))
+
+		r.Header.Set("X-Remote-User", "admin")
+		e.ServeHTTP(w, r)
+
+		if w.Code != test.Code {
+			t.Errorf("test %d: expecting status code %d, got %d: %s", n+1, test.Code, w.Code, w.Body)
+		}
+
+		if env := getEnvironment(e, test.Path); env != nil && env.Status != test.Expectation {
+			t.Errorf("test %d: expecting status %s, got %s", n+1, test.Expectation, env.Status)
+		}
+	}
+
+	f, err := store.GetFile(artefacts.UserDirectory, "userA", "envA-1", metaFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	metadata, _ := io.ReadAll(f)
+
+	if str := string(metadata); !strings.Contains(str, "status: archived") || !strings.Contains(str, "tagA") {
+		t.Errorf("expecting status to be added to existing metadata, got %q", str)
+	}
+
+	env, err := e.loadEnvironment(artefacts.UserDirectory, "userA", "envA-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if env.Status != envArchived {
+		t.Errorf("expecting status read from metadata to be archived, got %s", env.Status)
+	}
+
+	e.setEnvironment("users/userA/envA-1", env)
+
+	if env := getEnvironment(e, "users/userA/envA-1"); len(env.Transitions) != 3 {
+		t.Errorf("expecting 3 recorded statuses, got %v", env.Transitions)
+	}
+}
@@ -0,0 +1,65 @@
+package environments
+
+import (
+	"io"
+	"io/fs"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/wtsi-hgi/softpack-frontend/artefacts"
+)
+
+// ArtefactStore is the storage backend from which environments are loaded and
+// to which their artefacts are written.
+//
+// Both *artefacts.Artefacts and *artefacts.Directory implement this interface.
+type ArtefactStore interface {
+	List(parts ...string) ([]string, error)
+	GetFile(usersOrGroups, userOrGroup, env, name string) (fs.File, error)
+	AddFilesToEnv(author artefacts.Author, usersOrGroups, userOrGroup, env string, files map[string]io.Reader) error
+	RemoveEnvironment(author artefacts.Author, usersOrGroups, userOrGroup, env string) error
+	Watch() (<-chan string, func())
+}
+
+// historyStore is implemented by stores that keep a history of changes to
+// environments.
+type historyStore interface {
+	History(usersOrGroups, userOrGroup, env string) ([]artefacts.Revision, error)
+	GetEnvAt(hash plumbing.Hash, usersOrGroups, userOrGroup, env string) (artefacts.Environment, error)
+	DiffFile(from, to plumbing.Hash, usersOrGroups, userOrGroup, env, name string) (string, error)
+}
+
+// restoreStore is implemented by stores that can restore deleted
+// environments.
+type restoreStore interface {
+	Deleted(limit int) ([]artefacts.DeletedEnvironment, error)
+	RestoreEnvironment(author artefacts.Author, usersOrGroups, userOrGroup, env string) error
+}
+
+// timesStore is implemented by stores that can determine when environments
+// were created and last updated.
+type timesStore interface {
+	EnvironmentTimes(paths ...string) (map[string]artefacts.Times, error)
+}
+
+// fsStore is implemented by stores that can present their committed contents
+// as an fs.FS.
+type fsStore interface {
+	FS() (*artefacts.CommitFS, error)
+	FSAt(hash plumbing.Hash) (*artefacts.CommitFS, error)
+}
+
+// verifyStore is implemented by stores that verify the signatures of commits
+// pulled from a remote.
+type verifyStore interface {
+	Unverified() []string
+}
+
+var (
+	_ ArtefactStore = (*artefacts.Artefacts)(nil)
+	_ ArtefactStore = (*artefacts.Directory)(nil)
+	_ historyStore  = (*artefacts.Artefacts)(nil)
+	_ restoreStore  = (*artefacts.Artefacts)(nil)
+	_ timesStore    = (*artefacts.Artefacts)(nil)
+	_ fsStore       = (*artefacts.Artefacts)(nil)
+	_ verifyStore   = (*artefacts.Artefacts)(nil)
+)
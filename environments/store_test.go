@@ -0,0 +1,408 @@
+package environments
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/wtsi-hgi/softpack-frontend/artefacts"
+)
+
+type fakeStore struct {
+	mu      sync.Mutex
+	envs    map[string]map[string]string
+	opened  map[string]int
+	changes chan string
+}
+
+func newFakeStore(envs map[string]map[string]string) *fakeStore {
+	return &fakeStore{envs: envs, opened: make(map[string]int), changes: make(chan string, 1)}
+}
+
+func (f *fakeStore) List(parts ...string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if files, ok := f.envs[path.Join(parts...)]; ok {
+		names := make([]string, 0, len(files))
+
+		for name := range files {
+			names = append(names, name)
+		}
+
+		slices.Sort(names)
+
+		return names, nil
+	}
+
+	prefix := path.Join(parts...) + "/"
+
+	var names []string
+
+	for p := range f.envs {
+		if rest, ok := strings.CutPrefix(p, prefix); ok {
+			name, _, _ := strings.Cut(rest, "/")
+
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	if len(names) == 0 {
+		return nil, object.ErrDirectoryNotFound
+	}
+
+	return names, nil
+}
+
+func (f *fakeStore) GetEnv(usersOrGroups, userOrGroup, env string) (artefacts.Environment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	files, ok := f.envs[path.Join(usersOrGroups, userOrGroup, env)]
+	if !ok {
+		return nil, object.ErrDirectoryNotFound
+	}
+
+	readers := make(map[string]io.Reader, len(files))
+
+	for name, contents := range files {
+		readers[name] = strings.NewReader(contents)
+	}
+
+	return artefacts.EnvironmentFromReaders(readers), nil
+}
+
+func (f *fakeStore) GetFile(usersOrGroups, userOrGroup, env, name string) (fs.File, error) {
+	e, err := f.GetEnv(usersOrGroups, userOrGroup, env)
+	if err != nil {
+		return nil, err
+	}
+
+	file, ok := e[name]
+	if !ok {
+		return nil, object.ErrFileNotFound
+	}
+
+	f.mu.Lock()
+	f.opened[path.Join(usersOrGroups, userOrGroup, env, name)]++
+	f.mu.Unlock()
+
+	return file, nil
+}
+
+func (f *fakeStore) AddFilesToEnv(_ artefacts.Author, usersOrGroups, userOrGroup, env string, files map[string]io.Reader) error {
+	p := path.Join(usersOrGroups, userOrGroup, env)
+
+	f.mu.Lock()
+
+	envFiles := maps.Clone(f.envs[p])
+	if envFiles == nil {
+		envFiles = make(map[string]string)
+	}
+
+	for name, r := range files {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			f.mu.Unlock()
+
+			return err
+		}
+
+		envFiles[name] = string(data)
+	}
+
+	f.envs[p] = envFiles
+
+	f.mu.Unlock()
+
+	f.changes <- p
+
+	return nil
+}
+
+func (f *fakeStore) RemoveEnvironment(_ artefacts.Author, usersOrGroups, userOrGroup, env string) error {
+	p := path.Join(usersOrGroups, userOrGroup, env)
+
+	f.mu.Lock()
+	delete(f.envs, p)
+	f.mu.Unlock()
+
+	f.changes <- p
+
+	return nil
+}
+
+func (f *fakeStore) Watch() (<-chan string, func()) {
+	return f.changes, func() {}
+}
+
+func TestFakeStore(t *testing.T) {
+	store := newFakeStore(map[string]map[string]string{
+		"users/userA/envA-1": {environmentsFile: "description: A\npackages:\n - packageA\n"},
+		"groups/groupB/envB-1": {
+			environmentsFile: "description: B\npackages:\n - packageB\n",
+			moduleFile:       "",
+			readmeFile:       "README B",
+		},
+	})
+
+	e, err := New(store)
+	if err != nil {
+		t.Fatalf("unexpected error creating environments: %s", err)
+	}
+
+	s := httptest.NewServer(e)
+	defer s.Close()
+
+	if env := getEnvironment(e, "groups/groupB/envB-1"); env == nil || env.Status != envReady || env.ReadMe != "README B" {
+		t.Fatalf("expecting ready environment groups/groupB/envB-1, got %v", env)
+	}
+
+	if err = store.AddFilesToEnv(artefacts.Author{}, artefacts.UserDirectory, "userA", "envA-1", map[string]io.Reader{
+		builderOut: strings.NewReader("FAILED"),
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	waitFor(t, func() bool {
+		env := getEnvironment(e, "users/userA/envA-1")
+
+		return env != nil && env.Status == envFailed
+	})
+
+	if err = store.RemoveEnvironment(artefacts.Author{}, artefacts.GroupDirectory, "groupB", "envB-1"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	waitFor(t, func() bool {
+		return getEnvironment(e, "groups/groupB/envB-1") == nil
+	})
+
+	for n, test := range [...]struct {
+		Path   string
+		Status int
+	}{
+		{Path: "/environment/users/userA/envA-1/" + builderOut, Status: http.StatusOK},
+		{Path: "/history/users/userA/envA-1", Status: http.StatusNotImplemented},
+		{Path: "/deleted", Status: http.StatusNotImplemented},
+	} {
+		resp, err := http.Get(s.URL + test.Path)
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %s", n+1, err)
+		} else if resp.StatusCode != test.Status {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, test.Status, resp.StatusCode)
+		}
+
+		resp.Body.Close()
+	}
+}
+
+func TestLoadFrom(t *testing.T) {
+	files := make(map[string]map[string]string)
+
+	for n := range 20 {
+		files[fmt.Sprintf("users/user%d/env", n)] = map[string]string{
+			environmentsFile: "description: A\npackages:\n - packageA\n",
+			moduleFile:       "module",
+			readmeFile:       fmt.Sprintf("    module load HGI/user%d/env\n", n),
+			builderOut:       "OK",
+			singularityFile:  "Bootstrap: docker",
+		}
+		files[fmt.Sprintf("groups/group%d/env", n)] = map[string]string{
+			environmentsFile: "description: B\npackages:\n - packageB\n",
+			builderOut:       "FAILED",
+		}
+	}
+
+	files["groups/groupX/bad"] = map[string]string{readmeFile: "no softpack.yml"}
+
+	store := newFakeStore(files)
+	envs := make(environments)
+
+	if err := envs.LoadFrom(store, artefacts.UserDirectory, artefacts.GroupDirectory); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if len(envs) != 41 {
+		t.Fatalf("expecting 41 environments, got %d", len(envs))
+	} else if bad := envs["groups/groupX/bad"]; bad.Status != envInvalid {
+		t.Fatalf("expecting invalid environment, got status %d", bad.Status)
+	}
+
+	delete(envs, "groups/groupX/bad")
+
+	for p, env := range envs {
+		if expected := strings.HasPrefix(p, "users/"); (env.Status == envReady) != expected {
+			t.Errorf("%s: expecting ready to be %v, got status %d", p, expected, env.Status)
+		} else if expected && env.ModulePath != "HGI/"+env.Owner+"/env" {
+			t.Errorf("%s: expecting module path HGI/%s/env, got %q", p, env.Owner, env.ModulePath)
+		}
+	}
+
+	for p := range store.opened {
+		if name := path.Base(p); name != environmentsFile && name != readmeFile {
+			t.Errorf("expecting only required files to be read, read %s", p)
+		}
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	store := newFakeStore(map[string]map[string]string{
+		"users/userA/noSoftpack": {readmeFile: "README"},
+		"users/userA/noReadme": {
+			environmentsFile: "description: A\npackages:\n - packageA\n",
+			moduleFile:       "",
+		},
+		"users/userA/badYaml": {environmentsFile: "description: A\npackages: [\n"},
+		"users/userA/badMeta": {
+			environmentsFile: "description: A\npackages:\n - packageA\n",
+			moduleFile:       "",
+			readmeFile:       "README",
+			metaFile:         "tags: a\n",
+		},
+		"users/userA/good": {environmentsFile: "description: A\npackages:\n - packageA\n"},
+	})
+
+	e, err := New(store, UserHeader("X-Remote-User"), Admins("admin"))
+	if err != nil {
+		t.Fatalf("unexpected error creating environments: %s", err)
+	}
+
+	s := httptest.NewServer(e)
+	defer s.Close()
+
+	getInvalid := func(user string) *http.Response {
+		t.Helper()
+
+		req, _ := http.NewRequest(http.MethodGet, s.URL+"/admin/invalid", nil)
+
+		if user != "" {
+			req.Header.Set("X-Remote-User", user)
+		}
+
+		req.SetBasicAuth("admin", "")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		return resp
+	}
+
+	for n, user := range [...]string{"", "userA"} {
+		if resp := getInvalid(user); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("test %d: expecting status %d, got %d", n+1, http.StatusForbidden, resp.StatusCode)
+		}
+	}
+
+	resp := getInvalid("admin")
+
+	var invalid []invalidEnvironment
+
+	err = json.NewDecoder(resp.Body).Decode(&invalid)
+	resp.Body.Close()
+
+	if err != nil {
+		t.Fatalf("unexpected error decoding response: %s", err)
+	} else if len(invalid) != 4 {
+		t.Fatalf("expecting 4 invalid environments, got %v", invalid)
+	}
+
+	for n, test := range [...]struct {
+		Path, Error string
+	}{
+		{Path: "users/userA/badMeta", Error: metaFile + ": yaml: unmarshal errors:\n  line 1:"},
+		{Path: "users/userA/badYaml", Error: environmentsFile + ": yaml: line 2:"},
+		{Path: "users/userA/noReadme", Error: ErrMissingReadme.Error()},
+		{Path: "users/userA/noSoftpack", Error: ErrMissingSoftpack.Error()},
+	} {
+		if invalid[n].Path != test.Path {
+			t.Errorf("test %d: expecting path %q, got %q", n+1, test.Path, invalid[n].Path)
+		} else if !strings.HasPrefix(invalid[n].Error, test.Error) {
+			t.Errorf("test %d: expecting error starting %q, got %q", n+1, test.Error, invalid[n].Error)
+		}
+	}
+
+	if env := getEnvironment(e, "users/userA/noReadme"); env == nil || env.Status != envInvalid || env.Description != "A" {
+		t.Errorf("expecting invalid environment to keep its description, got %v", env)
+	}
+}
+
+func TestInvalidClientShape(t *testing.T) {
+	store := newFakeStore(map[string]map[string]string{
+		"users/userA/noSoftpack": {readmeFile: "README"},
+		"users/userA/badYaml":    {environmentsFile: "description: A\npackages: [\n"},
+		"users/userA/noPackages": {environmentsFile: "description: A\n"},
+	})
+
+	e, err := New(store)
+	if err != nil {
+		t.Fatalf("unexpected error creating environments: %s", err)
+	}
+
+	var envs map[string]map[string]json.RawMessage
+
+	if err = json.Unmarshal(e.snapshot.Current().Data, &envs); err != nil {
+		t.Fatalf("unexpected error decoding environments: %s", err)
+	}
+
+	for _, p := range [...]string{"users/userA/noSoftpack", "users/userA/badYaml", "users/userA/noPackages"} {
+		if err := checkClientShape(envs[p]); err != nil {
+			t.Errorf("%s: %s", p, err)
+		}
+	}
+}
+
+// checkClientShape checks that the encoded environment would be accepted by the
+// isEnvironments typeguard of the frontend.
+func checkClientShape(env map[string]json.RawMessage) error {
+	for field, v := range map[string]any{
+		"Tags":        new([]string),
+		"Packages":    new([]string),
+		"Description": new(string),
+		"ReadMe":      new(string),
+		"Status":      new(string),
+		"SoftPack":    new(bool),
+	} {
+		if raw, ok := env[field]; !ok || string(raw) == "null" {
+			return fmt.Errorf("expecting field %s to be set, got %s", field, raw)
+		} else if err := json.Unmarshal(raw, v); err != nil {
+			return fmt.Errorf("field %s: %w", field, err)
+		}
+	}
+
+	return nil
+}
+
+func getEnvironment(e *Environments, p string) *environment {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.environments[p]
+}
+
+func waitFor(t *testing.T, fn func() bool) {
+	t.Helper()
+
+	for range 100 {
+		if fn() {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("timed out waiting for condition")
+}
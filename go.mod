@@ -3,10 +3,13 @@ module github.com/wtsi-hgi/softpack-frontend
 go 1.22.5
 
 require (
+	github.com/ProtonMail/go-crypto v1.0.0
+	github.com/andybalholm/brotli v1.1.0
 	github.com/go-git/go-billy/v5 v5.5.0
 	github.com/go-git/go-git/v5 v5.12.0
 	github.com/go-ldap/ldap/v3 v3.4.8
 	github.com/gorilla/websocket v1.5.3
+	github.com/klauspost/compress v1.17.9
 	golang.org/x/net v0.22.0
 	gopkg.in/yaml.v3 v3.0.1
 	vimagination.zapto.org/httpencoding v1.0.0
@@ -20,7 +23,6 @@ require (
 	dario.cat/mergo v1.0.0 // indirect
 	github.com/Azure/go-ntlmssp v0.0.0-20221128193559-754e69321358 // indirect
 	github.com/Microsoft/go-winio v0.6.1 // indirect
-	github.com/ProtonMail/go-crypto v1.0.0 // indirect
 	github.com/cloudflare/circl v1.3.7 // indirect
 	github.com/cyphar/filepath-securejoin v0.2.4 // indirect
 	github.com/emirpasic/gods v1.18.1 // indirect
@@ -45,6 +45,10 @@ func execGit(t *testing.T, dir string, command ...string) {
 
 	cmd := exec.Command("git", append(append(make([]string, 0, len(command)), "-C", dir), command...)...)
 	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
 
 	if err := cmd.Run(); err != nil {
 		t.Fatalf("error creating test repo (%v): %s", cmd.Args, err)
@@ -80,3 +84,28 @@ func (r *Remote) Add(t *testing.T, files map[string]string) {
 func (r *Remote) URL() string {
 	return r.url
 }
+
+func (r *Remote) Path() string {
+	return r.path
+}
+
+func (r *Remote) Remove(t *testing.T, names ...string) {
+	t.Helper()
+
+	execGit(t, r.path, "config", "--bool", "core.bare", "false")
+	defer execGit(t, r.path, "config", "--bool", "core.bare", "true")
+
+	for _, name := range names {
+		execGit(t, r.path, "rm", "-r", name)
+		execGit(t, r.path, "commit", "-m", "Removed "+name)
+	}
+
+	execGit(t, r.path, "update-server-info")
+}
+
+func (r *Remote) Tag(t *testing.T, name string) {
+	t.Helper()
+
+	execGit(t, r.path, "tag", name)
+	execGit(t, r.path, "update-server-info")
+}
@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"runtime"
 	"time"
 
 	"github.com/go-git/go-git/v5/plumbing"
@@ -32,21 +33,46 @@ func main() {
 
 type Config struct {
 	Spack struct {
-		Version         string `yaml:"Version"`
-		CustomRepo      string `yaml:"CustomRepo"`
-		UpdateFrequency int    `yaml:"UpdateFrequency"`
-		Cache           string `yaml:"Cache"`
+		Version         string   `yaml:"Version"`
+		Versions        []string `yaml:"Versions"`
+		CustomRepo      string   `yaml:"CustomRepo"`
+		UpdateFrequency int      `yaml:"UpdateFrequency"`
+		Repos           []struct {
+			URL             string `yaml:"URL"`
+			Branch          string `yaml:"Branch"`
+			Path            string `yaml:"Path"`
+			UpdateFrequency int    `yaml:"UpdateFrequency"`
+		} `yaml:"Repos"`
+		Cache         string            `yaml:"Cache"`
+		WebhookSecret string            `yaml:"WebhookSecret"`
+		LocalRepo     string            `yaml:"LocalRepo"`
+		LocalSources  map[string]string `yaml:"LocalSources"`
 	} `yaml:"Spack"`
 	Artefacts struct {
-		Repo     string `yaml:"Repo"`
-		Username string `yaml:"Username"`
-		Password string `yaml:"Password"`
-		Cache    string `yaml:"Cache"`
+		Repo      string `yaml:"Repo"`
+		Directory string `yaml:"Directory"`
+		Username  string `yaml:"Username"`
+		Password  string `yaml:"Password"`
+		Cache     string `yaml:"Cache"`
+		Committer struct {
+			Name  string `yaml:"Name"`
+			Email string `yaml:"Email"`
+		} `yaml:"Committer"`
+		SigningKey        string `yaml:"SigningKey"`
+		SigningPassphrase string `yaml:"SigningPassphrase"`
+		VerifyKeyring     string `yaml:"VerifyKeyring"`
+		RejectUnverified  bool   `yaml:"RejectUnverified"`
+		Depth             int    `yaml:"Depth"`
+		Sparse            bool   `yaml:"Sparse"`
+		LargeObjects      int64  `yaml:"LargeObjects"`
 	} `yaml:"Artefacts"`
 	Server struct {
-		IP   string `yaml:"IP"`
-		Port string `yaml:"Port"`
-		Path string `yaml:"Path"`
+		IP           string   `yaml:"IP"`
+		Port         string   `yaml:"Port"`
+		Path         string   `yaml:"Path"`
+		UserHeader   string   `yaml:"UserHeader"`
+		Admins       []string `yaml:"Admins"`
+		BuilderToken string   `yaml:"BuilderToken"`
 	} `yaml:"Server"`
 	LDAP struct {
 		Server string `yaml:"Server"`
@@ -87,11 +113,41 @@ func run() error {
 		spackDebug   = []any{"version", c.Spack.Version}
 	)
 
+	if len(c.Spack.Versions) > 0 {
+		versions := make([]plumbing.ReferenceName, len(c.Spack.Versions))
+
+		for n, version := range c.Spack.Versions {
+			versions[n] = plumbing.NewTagReferenceName(version)
+		}
+
+		spackOptions = append(spackOptions, spack.Versions(versions...))
+		spackDebug = append(spackDebug, "versions", c.Spack.Versions)
+	}
+
+	for _, repo := range c.Spack.Repos {
+		spackOptions = append(spackOptions, spack.RemoteBranch(repo.URL, repo.Branch, repo.Path, time.Duration(repo.UpdateFrequency)*time.Second))
+		spackDebug = append(spackDebug, "remote", repo.URL)
+	}
+
 	if c.Spack.CustomRepo != "" {
 		spackOptions = append(spackOptions, spack.Remote(c.Spack.CustomRepo, time.Duration(c.Spack.UpdateFrequency)*time.Second))
 		spackDebug = append(spackDebug, "remote", c.Spack.CustomRepo)
 	}
 
+	if c.Spack.LocalRepo != "" {
+		spackOptions = append(spackOptions, spack.LocalRepo(c.Spack.LocalRepo))
+		spackDebug = append(spackDebug, "localRepo", c.Spack.LocalRepo)
+	}
+
+	for version, source := range c.Spack.LocalSources {
+		spackOptions = append(spackOptions, spack.LocalSource(plumbing.NewTagReferenceName(version), source))
+		spackDebug = append(spackDebug, "localSource", version+"="+source)
+	}
+
+	if c.Spack.WebhookSecret != "" {
+		spackOptions = append(spackOptions, spack.WebhookSecret(c.Spack.WebhookSecret))
+	}
+
 	if c.Spack.Cache != "" {
 		spackOptions = append(spackOptions, spack.CacheDir(c.Spack.Cache))
 		spackDebug = append(spackDebug, "cache", c.Spack.Cache)
@@ -104,28 +160,42 @@ func run() error {
 		return fmt.Errorf("error loading spack repo: %w", err)
 	}
 
-	artefactOptions := []artefacts.Option{artefacts.Remote(c.Artefacts.Repo)}
-	artefactsDebug := []any{"repo", c.Artefacts.Repo}
+	a, err := loadArtefacts(c)
+	if err != nil {
+		return fmt.Errorf("error loading artefacts: %w", err)
+	}
 
-	if c.Artefacts.Cache != "" {
-		artefactOptions = append(artefactOptions, artefacts.FS(c.Artefacts.Cache))
-		artefactsDebug = append(artefactsDebug, "cache", c.Artefacts.Cache)
+	logMemoryUsage("loaded artefacts")
+
+	slog.Debug("loading environments")
+
+	var environmentOptions []environments.Option
+
+	if c.Server.UserHeader != "" {
+		slog.Debug("taking acting user from header", "header", c.Server.UserHeader)
+
+		environmentOptions = append(environmentOptions, environments.UserHeader(c.Server.UserHeader))
 	}
 
-	slog.Debug("loading artefacts", artefactsDebug...)
+	if len(c.Server.Admins) > 0 {
+		if c.Server.UserHeader == "" {
+			slog.Warn("admins configured without a user header; admin endpoints will be unavailable")
+		}
 
-	a, err := artefacts.New(artefactOptions...)
-	if err != nil {
-		return fmt.Errorf("error loading artefacts: %w", err)
+		environmentOptions = append(environmentOptions, environments.Admins(c.Server.Admins...))
 	}
 
-	slog.Debug("loading environments")
+	if c.Server.BuilderToken != "" {
+		environmentOptions = append(environmentOptions, environments.BuilderToken(c.Server.BuilderToken))
+	}
 
-	e, err := environments.New(a)
+	e, err := environments.New(a, environmentOptions...)
 	if err != nil {
 		return fmt.Errorf("error loading environments: %w", err)
 	}
 
+	logMemoryUsage("loaded environments")
+
 	var h http.Handler
 
 	if dev := os.Getenv("DEV"); dev == "" {
@@ -139,6 +209,72 @@ func run() error {
 	return startServer(c, h)
 }
 
+// logMemoryUsage reports the current memory statistics, which will include any
+// garbage not yet collected.
+func logMemoryUsage(msg string) {
+	var m runtime.MemStats
+
+	runtime.ReadMemStats(&m)
+
+	slog.Info(msg, "heapAlloc", m.HeapAlloc, "heapObjects", m.HeapObjects, "sys", m.Sys)
+}
+
+func loadArtefacts(c *Config) (environments.ArtefactStore, error) {
+	if c.Artefacts.Directory != "" {
+		slog.Debug("loading artefacts", "directory", c.Artefacts.Directory)
+
+		return artefacts.NewDirectory(c.Artefacts.Directory)
+	}
+
+	artefactOptions := []artefacts.Option{artefacts.Remote(c.Artefacts.Repo)}
+	artefactsDebug := []any{"repo", c.Artefacts.Repo}
+
+	if c.Artefacts.Cache != "" {
+		artefactOptions = append(artefactOptions, artefacts.FS(c.Artefacts.Cache))
+		artefactsDebug = append(artefactsDebug, "cache", c.Artefacts.Cache)
+	}
+
+	if c.Artefacts.Depth > 0 {
+		artefactOptions = append(artefactOptions, artefacts.Depth(c.Artefacts.Depth))
+		artefactsDebug = append(artefactsDebug, "depth", c.Artefacts.Depth)
+	}
+
+	if c.Artefacts.Sparse {
+		artefactOptions = append(artefactOptions, artefacts.Sparse())
+		artefactsDebug = append(artefactsDebug, "sparse", true)
+	}
+
+	if c.Artefacts.LargeObjects > 0 {
+		artefactOptions = append(artefactOptions, artefacts.LargeObjectThreshold(c.Artefacts.LargeObjects))
+		artefactsDebug = append(artefactsDebug, "largeObjects", c.Artefacts.LargeObjects)
+	}
+
+	if c.Artefacts.Committer.Name != "" {
+		artefactOptions = append(artefactOptions, artefacts.Committer(c.Artefacts.Committer.Name, c.Artefacts.Committer.Email))
+		artefactsDebug = append(artefactsDebug, "committer", c.Artefacts.Committer.Name)
+	}
+
+	if c.Artefacts.SigningKey != "" {
+		artefactOptions = append(artefactOptions, artefacts.SigningKey(c.Artefacts.SigningKey, c.Artefacts.SigningPassphrase))
+		artefactsDebug = append(artefactsDebug, "signingKey", c.Artefacts.SigningKey)
+	}
+
+	if c.Artefacts.VerifyKeyring != "" {
+		mode := artefacts.FlagUnverified
+
+		if c.Artefacts.RejectUnverified {
+			mode = artefacts.RejectUnverified
+		}
+
+		artefactOptions = append(artefactOptions, artefacts.VerifyCommits(c.Artefacts.VerifyKeyring, mode))
+		artefactsDebug = append(artefactsDebug, "verifyKeyring", c.Artefacts.VerifyKeyring, "rejectUnverified", c.Artefacts.RejectUnverified)
+	}
+
+	slog.Debug("loading artefacts", artefactsDebug...)
+
+	return artefacts.New(artefactOptions...)
+}
+
 func startServer(c *Config, h http.Handler) error {
 	if c.Server.Path != "" {
 		h = http.StripPrefix(c.Server.Path, h)
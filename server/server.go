@@ -32,6 +32,7 @@ func mux(s, e, l, files http.Handler) http.Handler {
 
 	sm.Handle(environmentsPath+"/", http.StripPrefix(environmentsPath, e))
 	sm.Handle(recipesPath, http.StripPrefix(recipesPath, s))
+	sm.Handle(recipesPath+"/", http.StripPrefix(recipesPath, s))
 	sm.Handle(ldapPath, http.StripPrefix(ldapPath, l))
 	sm.Handle("/", files)
 
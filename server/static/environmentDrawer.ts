@@ -4,8 +4,11 @@ import {code, div, h2, hr, li, pre, ul} from './lib/html.js';
 import Markdown from './lib/markdown.js';
 import {goto} from './lib/router.js';
 import {environments} from './environments.js';
+import {buildLog, subscribeLog, unsubscribeLog} from './rpc.js';
 
 class Opener extends HTMLDialogElement {
+	onDisconnect?: () => void;
+
 	connectedCallback() {
 		amendNode(document.documentElement, {"class": {"modelOpen": true}});
 		this.showModal();
@@ -14,6 +17,7 @@ class Opener extends HTMLDialogElement {
 	disconnectedCallback() {
 		amendNode(document.documentElement, {"class": {"modelOpen": false}});
 		this.close();
+		this.onDisconnect?.();
 	}
 }
 
@@ -43,7 +47,9 @@ export default ({path}: {path?: string}) => {
 		return new Text();
 	}
 
-	return dialog({"onclick": function(this: Opener, e: MouseEvent) {
+	const building = env.status === "queued" || env.status === "building",
+	      log = pre({"class": "buildLog"}),
+	      d = dialog({"onclick": function(this: Opener, e: MouseEvent) {
 		const {left} = this.getBoundingClientRect();
 
 		if (e.clientX < left) {
@@ -62,8 +68,30 @@ export default ({path}: {path?: string}) => {
 		div({"class": "description"}, env.description),
 		hr(),
 		h2("Packages"),
-		env.packages.toDOM(ul({"class": "packages"}), pkg => li(pkg[0] + (pkg[1] ? "@" + pkg[1] : "")))
-	]);
+		env.packages.toDOM(ul({"class": "packages"}), pkg => li(pkg[0] + (pkg[1] ? "@" + pkg[1] : ""))),
+		building ? [
+			hr(),
+			h2("Build Log"),
+			log
+		] : []
+	      ]);
+
+	if (building && path) {
+		const chunks = buildLog.when(({Path, Chunk}) => {
+			if (Path === path) {
+				log.append(Chunk);
+			}
+		});
+
+		subscribeLog(path).then(sofar => log.prepend(sofar)).catch(() => {});
+
+		d.onDisconnect = () => {
+			chunks.cancel();
+			unsubscribeLog(path).catch(() => {});
+		};
+	}
+
+	return d;
 };
 
 add({
@@ -126,6 +154,15 @@ add({
 			}
 		},
 
+		" .buildLog": {
+			"font-size": "12px",
+			"white-space": "pre-wrap",
+			"max-height": "30em",
+			"overflow-y": "auto",
+			"background-color": "#f5f5f5",
+			"padding": "1em"
+		},
+
 		" .description": {
 			"font-size": "14px",
 			"font-family": `"Inter", -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif, "Apple Color Emoji", "Segoe UI Emoji"`,
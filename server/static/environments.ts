@@ -1,6 +1,7 @@
 import type {Binding} from './lib/bind.js';
 import type {MultiSelect} from './lib/multiselect.js';
 import type {Subscribed} from './lib/inter.js';
+import type {Status} from './rpc.js';
 import bind from './lib/bind.js';
 import {add} from './lib/css.js';
 import {amendNode, bindCustomElement} from './lib/dom.js';
@@ -25,7 +26,7 @@ class Environment {
 	[node]: HTMLLIElement;
 	#sortKey: string;
 	tags: Binding<string[]>;
-	#state: Binding<number>;
+	#state: Binding<Status>;
 	user = "";
 	group = "";
 	packages: Binding<[string, string?][]>;
@@ -48,7 +49,7 @@ class Environment {
 			groups.addEntry(this.group = pathParts[1]);
 		}
 
-		this[node] = li({"class": `${envData.SoftPack ? "softpack" : "module"} ${(this.#state = bind(envData.Status)).transform(state => statuses[state])}`, "onclick": () => {
+		this[node] = li({"class": `${envData.SoftPack ? "softpack" : "module"} ${this.#state = bind(envData.Status)}`, "onclick": () => {
 			goto(`?envId=${encodeURIComponent(path)}`);
 		}}, [
 			h2(`${this.name = name}${(this.version = version)  ? "-" + version : ""}`),
@@ -82,16 +83,20 @@ class Environment {
 		this.readme(envData.ReadMe);
 	}
 
+	get status() {
+		return this.#state();
+	}
+
 	compare(b: Environment) {
 		return stringSort(this.#sortKey, b.#sortKey);
 	}
 
 	#filter(filter: Filter) {
 		if (filter.building) {
-			if (this.#state() === 2) {
+			if (this.#state() === "ready") {
 				return false;
 			}
-		} else if (this.#state() === 1) {
+		} else if (this.#state() === "failed") {
 			return false;
 		}
 
@@ -280,8 +285,7 @@ bindCustomElement("environment-list", EnvironmentList);
 
 export const environmentContainer = () => new EnvironmentList(environments[node], filter);
 
-const statuses = ["building", "failed", "ready"],
-      filterMatch = {"class": {"filtered": false}},
+const filterMatch = {"class": {"filtered": false}},
       filterUnmatch = {"class": {"filtered": true}},
       latestVersion = {"class": {"oldVersion": false}},
       olderVersion = {"class": {"oldVersion": true}},
@@ -453,6 +457,14 @@ add({
 				"background-color": "#ff1943"
 			},
 
+			".deprecated:before": {
+				"background-color": "#ffa500"
+			},
+
+			".archived:before, .invalid:before": {
+				"background-color": "#999"
+			},
+
 			">h2": {
 				"display": "inline",
 				"margin": 0,
@@ -1,19 +1,50 @@
+import type {TypeGuardOf} from './lib/typeguard.js';
 import {HTTPRequest, WS} from './lib/conn.js';
+import {Subscription} from './lib/inter.js';
 import {RPC} from './lib/rpc.js';
-import {Arr, Bool, Int, Null, Obj, Or, Rec, Str} from './lib/typeguard.js';
+import {Arr, Bool, Int, Null, Obj, Opt, Or, Rec, Str, Val} from './lib/typeguard.js';
 
 const rpc = new RPC();
 
+let lastVersion = -1;
+
+export type Status = TypeGuardOf<typeof isStatus>;
+
+export type Environments = TypeGuardOf<typeof isEnvironments>;
+
 export const
 isStr = Str(),
 isStrArr = Arr(isStr),
-rpcInit = (url: string) => WS(url).then(conn => rpc.reconnect(conn)),
-environmentUpdate = rpc.subscribe(-1, Rec(isStr, Or(Obj({
+isStatus = Or(Val("queued"), Val("building"), Val("failed"), Val("ready"), Val("deprecated"), Val("archived"), Val("invalid")),
+rpcInit = (url: string) => WS(url).then(conn => {
+	lastVersion = -1;
+
+	return rpc.reconnect(conn);
+}),
+isEnvironments = Rec(isStr, Or(Obj({
 	Tags: isStrArr,
 	Packages: isStrArr,
 	Description: isStr,
 	ReadMe: isStr,
-	Status: Int(0, 2),
-	SoftPack: Bool()
-}), Null()))),
+	Status: isStatus,
+	SoftPack: Bool(),
+	Error: Opt(isStr)
+}), Null())),
+environmentUpdate = new Subscription<Environments>(sFn => rpc.subscribe(-1, Obj({
+	Version: Int(0),
+	Environments: isEnvironments
+})).when(({Version, Environments}) => {
+	if (Version > lastVersion) {
+		lastVersion = Version;
+
+		sFn(Environments);
+	}
+})),
+buildLog = rpc.subscribe(-2, Obj({
+	Path: isStr,
+	Chunk: isStr,
+	Final: Opt(Bool())
+})),
+subscribeLog = (path: string) => rpc.request("subscribeLog", path, isStr),
+unsubscribeLog = (path: string) => rpc.request("unsubscribeLog", path),
 getUserGroups = (user: string) => HTTPRequest("ldap", {"method": "POST", "data": user, "response": "json", "checker": isStrArr});
@@ -0,0 +1,186 @@
+package spack
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	buildinfo "runtime/debug"
+	"strconv"
+)
+
+const (
+	cacheFormat = 2
+
+	// recipeParser must be incremented whenever a change to
+	// parseRecipeVersions would alter the versions it finds.
+	recipeParser = 1
+)
+
+// parserVersion identifies the recipe parser, and the versions of the python
+// tokeniser and parser it relies on, so that any change to how recipes are
+// parsed invalidates existing caches.
+var parserVersion = recipeParserVersion() //nolint:gochecknoglobals
+
+func recipeParserVersion() string {
+	version := strconv.Itoa(recipeParser)
+
+	info, ok := buildinfo.ReadBuildInfo()
+	if !ok {
+		return version
+	}
+
+	for _, dep := range info.Deps {
+		switch dep.Path {
+		case "vimagination.zapto.org/parser", "vimagination.zapto.org/python":
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+
+			version += " " + dep.Path + "@" + dep.Version
+		}
+	}
+
+	return version
+}
+
+type cacheHeader struct {
+	Format   int
+	Ref      string
+	Commit   string
+	Parser   string
+	Checksum string
+}
+
+func cachePath(cacheDir, identifier string) string {
+	return filepath.Join(cacheDir, base64.RawURLEncoding.EncodeToString([]byte(identifier)))
+}
+
+// loadFromCache reads the recipes stored in a cache file, along with the commit
+// they were read from.
+func loadFromCache(cacheFile, ref string) (map[string]recipe, string, error) {
+	f, err := os.Open(cacheFile)
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer f.Close()
+
+	return decodeCache(f, ref)
+}
+
+func decodeCache(r io.Reader, ref string) (map[string]recipe, string, error) {
+	br := bufio.NewReader(r)
+
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		return nil, "", err
+	}
+
+	var header cacheHeader
+
+	if err = json.Unmarshal(line, &header); err != nil {
+		return nil, "", err
+	}
+
+	switch {
+	case header.Format != cacheFormat:
+		return nil, "", ErrCacheFormat
+	case header.Parser != parserVersion:
+		return nil, "", ErrCacheParser
+	case header.Ref != ref:
+		return nil, "", ErrCacheRef
+	}
+
+	body, err := io.ReadAll(br)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if checksum(body) != header.Checksum {
+		return nil, "", ErrCacheChecksum
+	}
+
+	var recipes map[string]recipe
+
+	if err = json.Unmarshal(body, &recipes); err != nil {
+		return nil, "", err
+	}
+
+	return recipes, header.Commit, nil
+}
+
+func checksum(p []byte) string {
+	sum := sha256.Sum256(p)
+
+	return hex.EncodeToString(sum[:])
+}
+
+func writeToCache(cacheFile, ref, commit string, recipes map[string]recipe) error {
+	dir := filepath.Dir(cacheFile)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, filepath.Base(cacheFile)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+
+	if err = encodeCache(f, ref, commit, recipes); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	if err = f.Sync(); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), cacheFile)
+}
+
+func encodeCache(w io.Writer, ref, commit string, recipes map[string]recipe) error {
+	var body bytes.Buffer
+
+	if err := json.NewEncoder(&body).Encode(recipes); err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(w).Encode(cacheHeader{
+		Format:   cacheFormat,
+		Ref:      ref,
+		Commit:   commit,
+		Parser:   parserVersion,
+		Checksum: checksum(body.Bytes()),
+	}); err != nil {
+		return err
+	}
+
+	_, err := body.WriteTo(w)
+
+	return err
+}
+
+var (
+	ErrCacheFormat   = errors.New("unknown cache format")
+	ErrCacheParser   = errors.New("cache created by different parser version")
+	ErrCacheRef      = errors.New("cache created for different reference")
+	ErrCacheChecksum = errors.New("invalid cache checksum")
+	ErrCacheCommit   = errors.New("cache created from a different commit")
+)
@@ -0,0 +1,77 @@
+package spack
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCacheFile(t *testing.T) {
+	recipes := map[string]recipe{
+		"abc": {"abc", []string{"1.1", "1.2"}, ""},
+		"def": {"def", []string{"dev"}, ""},
+	}
+
+	cacheFile := filepath.Join(t.TempDir(), "cache", "file")
+
+	if err := writeToCache(cacheFile, "refs/tags/v1", "0123", recipes); err != nil {
+		t.Fatalf("unexpected error writing cache: %s", err)
+	}
+
+	if entries, err := os.ReadDir(filepath.Dir(cacheFile)); err != nil {
+		t.Fatalf("unexpected error reading cache dir: %s", err)
+	} else if len(entries) != 1 {
+		t.Errorf("expecting 1 file in cache dir, got %d", len(entries))
+	}
+
+	if loaded, commit, err := loadFromCache(cacheFile, "refs/tags/v1"); err != nil {
+		t.Errorf("unexpected error loading cache: %s", err)
+	} else if !reflect.DeepEqual(loaded, recipes) {
+		t.Errorf("expecting recipes %v, got %v", recipes, loaded)
+	} else if commit != "0123" {
+		t.Errorf("expecting commit %q, got %q", "0123", commit)
+	}
+
+	if _, _, err := loadFromCache(cacheFile, "refs/tags/v2"); !errors.Is(err, ErrCacheRef) {
+		t.Errorf("expecting error %q, got %q", ErrCacheRef, err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := encodeCache(&buf, "ref", "", recipes); err != nil {
+		t.Fatalf("unexpected error encoding cache: %s", err)
+	}
+
+	data := buf.String()
+
+	for n, test := range [...]struct {
+		Data string
+		Err  error
+	}{
+		{
+			Data: data[:len(data)-5],
+			Err:  ErrCacheChecksum,
+		},
+		{
+			Data: strings.Replace(data, `"Parser":`+strconv.Quote(parserVersion), `"Parser":"other"`, 1),
+			Err:  ErrCacheParser,
+		},
+		{
+			Data: strings.Replace(data, `"Format":2`, `"Format":1`, 1),
+			Err:  ErrCacheFormat,
+		},
+		{
+			Data: strings.Replace(data, `"1.1"`, `"1.3"`, 1),
+			Err:  ErrCacheChecksum,
+		},
+	} {
+		if _, _, err := decodeCache(strings.NewReader(test.Data), "ref"); !errors.Is(err, test.Err) {
+			t.Errorf("test %d: expecting error %q, got %q", n+1, test.Err, err)
+		}
+	}
+}
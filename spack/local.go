@@ -0,0 +1,143 @@
+package spack
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func openLocalRepo(repoPath string, spackVersion plumbing.ReferenceName) (billy.Filesystem, string, error) {
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	hash, err := r.ResolveRevision(plumbing.Revision(spackVersion))
+	if err != nil {
+		return nil, "", err
+	}
+
+	tree, err := commitTree(r, *hash)
+	if err != nil {
+		return nil, "", err
+	}
+
+	packages, err := tree.Tree(spackPackages)
+	if err != nil {
+		return nil, "", err
+	}
+
+	builtinFS := memfs.New()
+
+	if err := packages.Files().ForEach(func(f *object.File) error {
+		if path.Base(f.Name) != "package.py" {
+			return nil
+		}
+
+		rc, err := f.Reader()
+		if err != nil {
+			return err
+		}
+
+		defer rc.Close()
+
+		return copyToFS(builtinFS, path.Join(spackPackages, f.Name), rc)
+	}); err != nil {
+		return nil, "", err
+	}
+
+	return builtinFS, hash.String(), nil
+}
+
+func copyToFS(bfs billy.Filesystem, name string, r io.Reader) error {
+	f, err := bfs.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	return f.Close()
+}
+
+func loadBuiltinFromSource(source string) (map[string]recipe, error) {
+	fi, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var builtinFS billy.Filesystem
+
+	if fi.IsDir() {
+		builtinFS = osfs.New(source)
+	} else if builtinFS, err = readTarball(source); err != nil {
+		return nil, err
+	}
+
+	return readRecipes(builtinFS, spackPackages)
+}
+
+func readTarball(tarball string) (billy.Filesystem, error) {
+	f, err := os.Open(tarball)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+
+	if magic, err := r.(*bufio.Reader).Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+
+		defer gr.Close()
+
+		r = gr
+	}
+
+	builtinFS := memfs.New()
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if hdr.Typeflag != tar.TypeReg || path.Base(hdr.Name) != "package.py" {
+			continue
+		}
+
+		pos := strings.Index(hdr.Name, spackPackages+"/")
+		if pos < 0 {
+			continue
+		}
+
+		if err := copyToFS(builtinFS, hdr.Name[pos:], tr); err != nil {
+			return nil, err
+		}
+	}
+
+	return builtinFS, nil
+}
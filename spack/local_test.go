@@ -0,0 +1,111 @@
+package spack
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/wtsi-hgi/softpack-frontend/internal/git"
+)
+
+var localRecipes = map[string]string{
+	spackPackages + "/abc/package.py": "version(\"1.1\")\nversion(\"1.2\")",
+	spackPackages + "/def/package.py": "version(\"dev\")\nversion(\"3.1.3\")",
+}
+
+var localExpectation = map[string]recipe{
+	"abc": {"abc", []string{"1.1", "1.2"}, ""},
+	"def": {"def", []string{"dev", "3.1.3"}, ""},
+}
+
+func TestLocalRepo(t *testing.T) {
+	sr := git.New(t)
+	sr.Add(t, localRecipes)
+
+	spackRepo = ""
+
+	s, err := New(plumbing.NewBranchReferenceName("master"), LocalRepo(sr.Path()), CacheDir(t.TempDir()))
+	if err != nil {
+		t.Fatalf("unexpected error creating spack object: %s", err)
+	}
+
+	if recipes := s.versions["master"].recipes; !reflect.DeepEqual(recipes, localExpectation) {
+		t.Errorf("expecting recipes %v, got %v", localExpectation, recipes)
+	}
+}
+
+func TestLocalSource(t *testing.T) {
+	dir := t.TempDir()
+
+	for name, contents := range localRecipes {
+		file := filepath.Join(dir, "checkout", name)
+
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatalf("unexpected error creating dir: %s", err)
+		} else if err = os.WriteFile(file, []byte(contents), 0o644); err != nil {
+			t.Fatalf("unexpected error writing file: %s", err)
+		}
+	}
+
+	writeTarball(t, filepath.Join(dir, "spack.tar"), false)
+	writeTarball(t, filepath.Join(dir, "spack.tar.gz"), true)
+
+	spackRepo = ""
+
+	for n, source := range [...]string{"checkout", "spack.tar", "spack.tar.gz"} {
+		s, err := New(plumbing.NewTagReferenceName("v1"), LocalSource(plumbing.NewTagReferenceName("v1"), filepath.Join(dir, source)))
+		if err != nil {
+			t.Fatalf("test %d: unexpected error creating spack object: %s", n+1, err)
+		}
+
+		if recipes := s.versions["v1"].recipes; !reflect.DeepEqual(recipes, localExpectation) {
+			t.Errorf("test %d: expecting recipes %v, got %v", n+1, localExpectation, recipes)
+		}
+	}
+	if _, err := New(plumbing.NewTagReferenceName("v1"), LocalSource(plumbing.NewTagReferenceName("v2"), filepath.Join(dir, "checkout"))); !errors.Is(err, ErrUnknownSourceVersion) {
+		t.Errorf("expecting error %q, got %q", ErrUnknownSourceVersion, err)
+	}
+}
+
+func writeTarball(t *testing.T, name string, compress bool) {
+	t.Helper()
+
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatalf("unexpected error creating tarball: %s", err)
+	}
+
+	defer f.Close()
+
+	var tw *tar.Writer
+
+	if compress {
+		gw := gzip.NewWriter(f)
+
+		defer gw.Close()
+
+		tw = tar.NewWriter(gw)
+	} else {
+		tw = tar.NewWriter(f)
+	}
+
+	defer tw.Close()
+
+	for name, contents := range localRecipes {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     "spack-1.0/" + name,
+			Typeflag: tar.TypeReg,
+			Mode:     0o644,
+			Size:     int64(len(contents)),
+		}); err != nil {
+			t.Fatalf("unexpected error writing tar header: %s", err)
+		} else if _, err = tw.Write([]byte(contents)); err != nil {
+			t.Fatalf("unexpected error writing tar file: %s", err)
+		}
+	}
+}
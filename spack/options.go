@@ -1,19 +1,68 @@
 package spack
 
-import "time"
+import (
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+type remote struct {
+	url             string
+	branch          string
+	path            string
+	updateFrequency time.Duration
+}
+
+func (r *remote) identifier() string {
+	if r.branch == "" && r.path == "" {
+		return r.url
+	}
+
+	return r.url + "#" + r.branch + ":" + r.path
+}
+
+func (r *remote) referenceName() plumbing.ReferenceName {
+	if r.branch == "" {
+		return ""
+	}
+
+	return plumbing.NewBranchReferenceName(r.branch)
+}
 
 type options struct {
-	remote                string
-	remoteUpdateFrequency time.Duration
-	cacheDir              string
+	remotes       []remote
+	versions      []plumbing.ReferenceName
+	cacheDir      string
+	webhookSecret []byte
+	localRepo     string
+	localSources  map[plumbing.ReferenceName]string
 }
 
 type Option func(*options)
 
+// Remote adds a custom recipe repository, which will be polled every
+// updateFrequency for changes.
+//
+// Remotes take priority in the order they are added, so a recipe in an earlier
+// remote will override the same recipe in a later remote, and all remotes
+// override the builtin recipes.
 func Remote(url string, updateFrequency time.Duration) Option {
+	return RemoteBranch(url, "", "", updateFrequency)
+}
+
+// RemoteBranch acts like Remote, but will checkout the given branch and read
+// the recipes from the packages directory within the given subdirectory of the
+// repository.
+//
+// An empty branch will use the default branch of the remote.
+func RemoteBranch(url, branch, path string, updateFrequency time.Duration) Option {
 	return func(o *options) {
-		o.remote = url
-		o.remoteUpdateFrequency = updateFrequency
+		o.remotes = append(o.remotes, remote{
+			url:             url,
+			branch:          branch,
+			path:            path,
+			updateFrequency: updateFrequency,
+		})
 	}
 }
 
@@ -22,3 +71,41 @@ func CacheDir(path string) Option {
 		o.cacheDir = path
 	}
 }
+
+// Versions adds additional spack versions whose builtin recipes will be served
+// alongside those of the default version.
+func Versions(versions ...plumbing.ReferenceName) Option {
+	return func(o *options) {
+		o.versions = append(o.versions, versions...)
+	}
+}
+
+// WebhookSecret enables the webhook endpoint, which will trigger an immediate
+// update of the custom remotes when it receives a push event signed with the
+// given secret.
+func WebhookSecret(secret string) Option {
+	return func(o *options) {
+		o.webhookSecret = []byte(secret)
+	}
+}
+
+// LocalRepo reads the builtin recipes for each spack version from a local git
+// repository, which may be bare, instead of cloning the spack repository.
+func LocalRepo(path string) Option {
+	return func(o *options) {
+		o.localRepo = path
+	}
+}
+
+// LocalSource reads the builtin recipes for the given spack version from
+// either a local spack checkout directory or a, possibly gzipped, release
+// tarball.
+func LocalSource(version plumbing.ReferenceName, path string) Option {
+	return func(o *options) {
+		if o.localSources == nil {
+			o.localSources = make(map[plumbing.ReferenceName]string)
+		}
+
+		o.localSources[version] = path
+	}
+}
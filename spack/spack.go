@@ -1,22 +1,26 @@
 package spack
 
 import (
-	"encoding/base64"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"log/slog"
-	"os"
+	"maps"
+	"net/http"
 	"path"
-	"path/filepath"
+	"slices"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-billy/v5/memfs"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/storage/memory"
 	"github.com/wtsi-hgi/softpack-frontend/compressed"
 	"vimagination.zapto.org/parser"
@@ -28,16 +32,39 @@ var spackRepo = "https://github.com/spack/spack.git" //nolint:gochecknoglobals
 const (
 	spackPackages  = "var/spack/repos/builtin/packages"
 	customPackages = "packages"
+	builtinRepo    = "builtin"
 )
 
-var debug = slog.Debug
+const maxRetryDelay = 30 * time.Minute
+
+var (
+	debug = slog.Debug
+	warn  = slog.Warn
+)
 
 type Spack struct {
-	builtIn  map[string]recipe
-	cacheDir string
+	cacheDir       string
+	defaultVersion string
+	versions       map[string]*builtin
+	webhookSecret  []byte
+
+	mu      sync.Mutex
+	remotes []*source
+}
+
+type builtin struct {
+	recipes map[string]recipe
 	*compressed.File
 }
 
+type source struct {
+	remote
+	recipes     map[string]recipe
+	cacheCommit string
+	status      remoteStatus
+	refresh     chan struct{}
+}
+
 func New(spackVersion plumbing.ReferenceName, opts ...Option) (*Spack, error) {
 	var o options
 
@@ -45,73 +72,155 @@ func New(spackVersion plumbing.ReferenceName, opts ...Option) (*Spack, error) {
 		opt(&o)
 	}
 
+	versions := append([]plumbing.ReferenceName{spackVersion}, o.versions...)
+
+	for version := range o.localSources {
+		if !slices.Contains(versions, version) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownSourceVersion, version.Short())
+		}
+	}
+
+	s := &Spack{
+		cacheDir:       o.cacheDir,
+		defaultVersion: spackVersion.Short(),
+		versions:       make(map[string]*builtin, len(o.versions)+1),
+		webhookSecret:  o.webhookSecret,
+	}
+
+	for _, version := range versions {
+		if _, ok := s.versions[version.Short()]; ok {
+			continue
+		}
+
+		builtinRecipes, err := loadBuiltin(version, &o)
+		if err != nil {
+			return nil, err
+		}
+
+		s.versions[version.Short()] = &builtin{
+			recipes: builtinRecipes,
+			File:    compressed.New("recipes.json"),
+		}
+	}
+
+	s.mergeRecipes()
+
+	for _, r := range o.remotes {
+		if err := s.watchRemote(r); err != nil {
+			warn("error loading remote recipes", "remote", r.url, "err", err)
+		}
+	}
+
+	return s, nil
+}
+
+func loadBuiltin(spackVersion plumbing.ReferenceName, o *options) (map[string]recipe, error) {
+	if source, ok := o.localSources[spackVersion]; ok {
+		builtinRecipes, err := loadBuiltinFromSource(source)
+		if err != nil {
+			return nil, err
+		}
+
+		debug("loaded builtin recipes from local source", "version", spackVersion.Short(), "source", source, "recipeCount", len(builtinRecipes))
+
+		return builtinRecipes, nil
+	}
+
 	var builtinRecipes map[string]recipe
 
 	if o.cacheDir != "" {
-		builtinRecipes = loadBuiltinFromCache(spackVersion, o.cacheDir)
+		builtinRecipes = loadBuiltinFromCache(spackVersion, o)
 	}
 
 	if len(builtinRecipes) == 0 {
 		var err error
 
-		if builtinRecipes, err = loadBuiltinFromRepo(spackVersion, o.cacheDir); err != nil {
+		if builtinRecipes, err = loadBuiltinFromRepo(spackVersion, o); err != nil {
 			return nil, err
 		}
 
-		debug("loaded builtin recipes from repo", "recipeCount", len(builtinRecipes))
+		debug("loaded builtin recipes from repo", "version", spackVersion.Short(), "recipeCount", len(builtinRecipes))
 	} else {
-		debug("loaded builtin recipes from cache", "recipeCount", len(builtinRecipes))
+		debug("loaded builtin recipes from cache", "version", spackVersion.Short(), "recipeCount", len(builtinRecipes))
 	}
 
-	s := &Spack{
-		builtIn:  builtinRecipes,
-		cacheDir: o.cacheDir,
-		File:     compressed.New("recipes.json"),
+	return builtinRecipes, nil
+}
+
+func loadBuiltinFromCache(spackVersion plumbing.ReferenceName, o *options) map[string]recipe {
+	builtinRecipes, commit, err := loadFromCache(cachePath(o.cacheDir, string(spackVersion)), string(spackVersion))
+	if err == nil {
+		if current, cerr := builtinCommit(spackVersion, o); cerr != nil {
+			debug("unable to check builtin recipe cache commit", "version", spackVersion.Short(), "err", cerr)
+		} else if current != commit {
+			builtinRecipes, err = nil, ErrCacheCommit
+		}
 	}
 
-	if o.remote != "" {
-		s.watchRemote(o.remote, o.remoteUpdateFrequency)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		debug("ignoring invalid builtin recipe cache", "version", spackVersion.Short(), "err", err)
 	}
 
-	return s, nil
+	return builtinRecipes
 }
 
-func loadBuiltinFromCache(spackVersion plumbing.ReferenceName, cacheDir string) map[string]recipe {
-	builtinRecipes, _ := loadFromCache(cachePath(cacheDir, string(spackVersion)))
+// builtinCommit returns the commit that the given spack version currently
+// refers to, without cloning the repository.
+func builtinCommit(spackVersion plumbing.ReferenceName, o *options) (string, error) {
+	if o.localRepo != "" {
+		r, err := git.PlainOpen(o.localRepo)
+		if err != nil {
+			return "", err
+		}
 
-	return builtinRecipes
-}
+		hash, err := r.ResolveRevision(plumbing.Revision(spackVersion))
+		if err != nil {
+			return "", err
+		}
 
-func loadFromCache(cacheFile string) (map[string]recipe, error) {
-	f, err := os.Open(cacheFile)
+		return hash.String(), nil
+	}
+
+	refs, err := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{spackRepo},
+	}).List(&git.ListOptions{PeelingOption: git.AppendPeeled})
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	defer f.Close()
+	var commit string
 
-	var recipes map[string]recipe
+	for _, ref := range refs {
+		switch ref.Name() {
+		case spackVersion + "^{}":
+			return ref.Hash().String(), nil
+		case spackVersion:
+			commit = ref.Hash().String()
+		}
+	}
 
-	if err = json.NewDecoder(f).Decode(&recipes); err != nil {
-		return nil, err
+	if commit == "" {
+		return "", plumbing.ErrReferenceNotFound
 	}
 
-	return recipes, nil
+	return commit, nil
 }
 
-func cachePath(cacheDir, identifier string) string {
-	return filepath.Join(cacheDir, base64.RawURLEncoding.EncodeToString([]byte(identifier)))
-}
+func loadBuiltinFromRepo(spackVersion plumbing.ReferenceName, o *options) (map[string]recipe, error) {
+	var (
+		builtinFS billy.Filesystem
+		commit    string
+		err       error
+	)
 
-func loadBuiltinFromRepo(spackVersion plumbing.ReferenceName, cacheDir string) (map[string]recipe, error) {
-	builtinFS := memfs.New()
+	if o.localRepo != "" {
+		builtinFS, commit, err = openLocalRepo(o.localRepo, spackVersion)
+	} else {
+		builtinFS, commit, err = cloneBuiltin(spackVersion)
+	}
 
-	if _, err := git.Clone(memory.NewStorage(), builtinFS, &git.CloneOptions{
-		URL:           spackRepo,
-		ReferenceName: spackVersion,
-		SingleBranch:  true,
-		Depth:         1,
-	}); err != nil {
+	if err != nil {
 		return nil, err
 	}
 
@@ -120,10 +229,10 @@ func loadBuiltinFromRepo(spackVersion plumbing.ReferenceName, cacheDir string) (
 		return nil, err
 	}
 
-	if cacheDir != "" {
-		debug("writing builtin recipes to cache", "recipeCount", len(builtinRecipes))
+	if o.cacheDir != "" {
+		debug("writing builtin recipes to cache", "version", spackVersion.Short(), "recipeCount", len(builtinRecipes))
 
-		if err := writeToCache(cachePath(cacheDir, string(spackVersion)), builtinRecipes); err != nil {
+		if err := writeToCache(cachePath(o.cacheDir, string(spackVersion)), string(spackVersion), commit, builtinRecipes); err != nil {
 			return nil, err
 		}
 	}
@@ -131,21 +240,29 @@ func loadBuiltinFromRepo(spackVersion plumbing.ReferenceName, cacheDir string) (
 	return builtinRecipes, nil
 }
 
-func writeToCache(cacheFile string, recipes map[string]recipe) error {
-	if err := os.MkdirAll(filepath.Dir(cacheFile), 0755); err != nil {
-		return err
-	}
+func cloneBuiltin(spackVersion plumbing.ReferenceName) (billy.Filesystem, string, error) {
+	builtinFS := memfs.New()
 
-	f, err := os.Create(cacheFile)
+	r, err := git.Clone(memory.NewStorage(), builtinFS, &git.CloneOptions{
+		URL:           spackRepo,
+		ReferenceName: spackVersion,
+		SingleBranch:  true,
+		Depth:         1,
+	})
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 
-	if err := json.NewEncoder(f).Encode(recipes); err != nil {
-		return err
+	return builtinFS, headCommit(r), nil
+}
+
+func headCommit(r *git.Repository) string {
+	head, err := r.Head()
+	if err != nil {
+		return ""
 	}
 
-	return nil
+	return head.Hash().String()
 }
 
 func readRecipes(bfs billy.Filesystem, base string) (map[string]recipe, error) {
@@ -154,28 +271,36 @@ func readRecipes(bfs billy.Filesystem, base string) (map[string]recipe, error) {
 	recipes := make(map[string]recipe, len(recipePaths))
 
 	for _, r := range recipePaths {
-		name := r.Name()
-
-		f, err := bfs.Open(path.Join(base, name, "package.py"))
-		if errors.Is(err, fs.ErrNotExist) {
-			continue
-		} else if err != nil {
+		if err := readRecipe(bfs, base, r.Name(), recipes); err != nil {
 			return nil, err
 		}
+	}
 
-		versions := parseRecipeVersions(f)
+	return recipes, nil
+}
 
-		f.Close()
+func readRecipe(bfs billy.Filesystem, base, name string, recipes map[string]recipe) error {
+	delete(recipes, name)
 
-		if versions != nil {
-			recipes[name] = recipe{
-				Name:     name,
-				Versions: versions,
-			}
+	f, err := bfs.Open(path.Join(base, name, "package.py"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	versions := parseRecipeVersions(f)
+
+	f.Close()
+
+	if versions != nil {
+		recipes[name] = recipe{
+			Name:     name,
+			Versions: versions,
 		}
 	}
 
-	return recipes, nil
+	return nil
 }
 
 func parseRecipeVersions(r io.Reader) []string {
@@ -215,105 +340,306 @@ func parseRecipeVersions(r io.Reader) []string {
 	return versions
 }
 
-func (s *Spack) watchRemote(url string, timeout time.Duration) error {
+func (s *Spack) watchRemote(r remote) error {
+	src := &source{
+		remote:  r,
+		refresh: make(chan struct{}, 1),
+	}
+
+	s.mu.Lock()
+	s.remotes = append(s.remotes, src)
+	s.mu.Unlock()
+
 	if s.cacheDir != "" {
-		if err := s.loadRemoteCache(url); err == nil {
-			debug("loaded remote recipes from cache")
+		if err := s.loadRemoteCache(src); err == nil {
+			debug("loaded remote recipes from cache", "remote", r.url)
 
-			go s.getRemote(url, timeout)
+			go s.getRemote(src)
 
 			return nil
 		}
 	}
 
-	debug("loading remote recipes from repo")
+	debug("loading remote recipes from repo", "remote", r.url)
 
-	return s.getRemote(url, timeout)
+	return s.getRemote(src)
 }
 
-func (s *Spack) getRemote(url string, timeout time.Duration) error {
+func (s *Spack) getRemote(src *source) error {
+	rr, err := s.cloneRemote(src)
+	if err != nil {
+		s.setRemoteError(src, err)
+	}
+
+	go s.pollRemote(src, rr)
+
+	return err
+}
+
+type remoteRepo struct {
+	repo *git.Repository
+	fs   billy.Filesystem
+}
+
+func (s *Spack) cloneRemote(src *source) (*remoteRepo, error) {
 	fs := memfs.New()
 
 	r, err := git.Clone(memory.NewStorage(), fs, &git.CloneOptions{
-		URL: url,
+		URL:           src.url,
+		ReferenceName: src.referenceName(),
+		SingleBranch:  src.branch != "",
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	rr := &remoteRepo{repo: r, fs: fs}
+
+	if err := s.updateRemote(src, rr); err != nil {
+		return nil, err
+	}
+
+	return rr, nil
+}
+
+func (s *Spack) pollRemote(src *source, rr *remoteRepo) {
+	delay := src.updateFrequency
+
+	for {
+		var timer <-chan time.Time
+
+		if delay > 0 {
+			timer = time.After(delay)
+		}
+
+		select {
+		case <-timer:
+		case <-src.refresh:
+		}
+
+		var err error
+
+		if rr == nil {
+			rr, err = s.cloneRemote(src)
+		} else {
+			err = s.pullRemote(src, rr)
+		}
+
+		if err != nil {
+			if delay > 0 {
+				delay = min(delay*2, max(src.updateFrequency, maxRetryDelay))
+			}
+
+			s.setRemoteError(src, err)
+			warn("error updating remote recipes", "remote", src.url, "err", err, "retry", delay)
+		} else {
+			delay = src.updateFrequency
+		}
+	}
+}
+
+func (s *Spack) pullRemote(src *source, rr *remoteRepo) error {
+	w, err := rr.repo.Worktree()
 	if err != nil {
 		return err
 	}
 
-	w, err := r.Worktree()
+	head, err := rr.repo.Head()
 	if err != nil {
 		return err
 	}
 
-	if err := s.updateRemote(url, fs); err != nil {
+	if err := w.Pull(&git.PullOptions{
+		ReferenceName: src.referenceName(),
+		SingleBranch:  src.branch != "",
+		Force:         true,
+	}); errors.Is(err, git.NoErrAlreadyUpToDate) {
+		s.setRemoteUpdated(src, rr)
+
+		return nil
+	} else if err != nil {
 		return err
 	}
 
-	if timeout > 0 {
-		go func() {
-			for {
-				time.Sleep(timeout)
-				if err := w.Pull(&git.PullOptions{
-					Force: true,
-				}); err != nil {
-					debug("error pulling remote recipes", "err", err)
-				} else if err = s.updateRemote(url, fs); err != nil {
-					debug("error parsing remote recipes", "err", err)
-				}
-			}
-		}()
+	return s.updateChangedRecipes(src, rr, head.Hash())
+}
+
+func (s *Spack) updateChangedRecipes(src *source, rr *remoteRepo, from plumbing.Hash) error {
+	base := path.Join(src.path, customPackages)
+
+	changed, err := changedRecipes(rr.repo, from, base)
+	if err != nil {
+		return err
+	}
+
+	debug("updating changed remote recipes", "remote", src.url, "changed", len(changed))
+
+	if len(changed) == 0 {
+		s.setRemoteUpdated(src, rr)
+
+		return nil
 	}
 
+	s.mu.Lock()
+	recipes := maps.Clone(src.recipes)
+	s.mu.Unlock()
+
+	if recipes == nil {
+		recipes = make(map[string]recipe, len(changed))
+	}
+
+	for name := range changed {
+		if err := readRecipe(rr.fs, base, name, recipes); err != nil {
+			return err
+		}
+	}
+
+	s.storeRemoteRecipes(src, rr, recipes)
+
 	return nil
 }
 
-func (s *Spack) loadRemoteCache(url string) error {
-	recipes, err := loadFromCache(cachePath(s.cacheDir, url))
+func changedRecipes(repo *git.Repository, from plumbing.Hash, base string) (map[string]struct{}, error) {
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	oldTree, err := commitTree(repo, from)
+	if err != nil {
+		return nil, err
+	}
+
+	newTree, err := commitTree(repo, head.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTree(oldTree, newTree)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]struct{})
+	prefix := base + "/"
+
+	for _, change := range changes {
+		for _, name := range [...]string{change.From.Name, change.To.Name} {
+			if rest, ok := strings.CutPrefix(name, prefix); ok {
+				name, _, _ = strings.Cut(rest, "/")
+				names[name] = struct{}{}
+			}
+		}
+	}
+
+	return names, nil
+}
+
+func commitTree(repo *git.Repository, hash plumbing.Hash) (*object.Tree, error) {
+	c, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Tree()
+}
+
+func (s *Spack) loadRemoteCache(src *source) error {
+	recipes, commit, err := loadFromCache(cachePath(s.cacheDir, src.identifier()), src.identifier())
 	if err != nil {
 		return err
 	}
 
-	s.mergeRecipes(recipes)
+	s.mu.Lock()
+	src.cacheCommit = commit
+	s.mu.Unlock()
+
+	s.setRemoteRecipes(src, recipes)
 
 	return nil
 }
 
-func (s *Spack) updateRemote(url string, fs billy.Filesystem) error {
-	recipes, err := readRecipes(fs, customPackages)
+func (s *Spack) updateRemote(src *source, rr *remoteRepo) error {
+	s.mu.Lock()
+	cacheCommit := src.cacheCommit
+	src.cacheCommit = ""
+	s.mu.Unlock()
+
+	if cacheCommit != "" && cacheCommit == headCommit(rr.repo) {
+		debug("remote recipe cache is up to date", "remote", src.url, "commit", cacheCommit)
+		s.setRemoteUpdated(src, rr)
+
+		return nil
+	}
+
+	recipes, err := readRecipes(rr.fs, path.Join(src.path, customPackages))
 	if err != nil {
 		return err
 	}
 
+	s.storeRemoteRecipes(src, rr, recipes)
+
+	return nil
+}
+
+func (s *Spack) storeRemoteRecipes(src *source, rr *remoteRepo, recipes map[string]recipe) {
 	if s.cacheDir != "" {
-		s.cacheRemoteRecipes(url, recipes)
+		s.cacheRemoteRecipes(src, rr, recipes)
 	}
 
-	s.mergeRecipes(recipes)
-
-	return nil
+	s.setRemoteRecipes(src, recipes)
+	s.setRemoteUpdated(src, rr)
 }
 
-func (s *Spack) cacheRemoteRecipes(url string, recipes map[string]recipe) {
-	debug("saving remote recipes to cache", "recipeCount", len(recipes))
-	writeToCache(cachePath(s.cacheDir, url), recipes)
+func (s *Spack) cacheRemoteRecipes(src *source, rr *remoteRepo, recipes map[string]recipe) {
+	debug("saving remote recipes to cache", "remote", src.url, "recipeCount", len(recipes))
+
+	if err := writeToCache(cachePath(s.cacheDir, src.identifier()), src.identifier(), headCommit(rr.repo), recipes); err != nil {
+		warn("error saving remote recipes to cache", "remote", src.url, "err", err)
+	}
 }
 
 type recipe struct {
 	Name     string
 	Versions []string
+	Repo     string
+}
+
+func (s *Spack) setRemoteRecipes(src *source, recipes map[string]recipe) {
+	s.mu.Lock()
+	src.recipes = recipes
+	s.mu.Unlock()
+
+	s.mergeRecipes()
 }
 
-func (s *Spack) mergeRecipes(recipes map[string]recipe) {
-	recipeList := make([]recipe, 0, len(recipes)+len(s.builtIn))
+func (s *Spack) mergeRecipes() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, version := range s.versions {
+		s.mergeVersionRecipes(version)
+	}
+}
+
+func (s *Spack) mergeVersionRecipes(version *builtin) {
+	merged := make(map[string]recipe, len(version.recipes))
+
+	for name, recipe := range version.recipes {
+		recipe.Repo = builtinRepo
+		merged[name] = recipe
+	}
 
-	for name, recipe := range s.builtIn {
-		if _, ok := recipes[name]; !ok {
-			recipeList = append(recipeList, recipe)
+	for i := len(s.remotes) - 1; i >= 0; i-- {
+		for name, recipe := range s.remotes[i].recipes {
+			recipe.Repo = redactURL(s.remotes[i].identifier())
+			merged[name] = recipe
 		}
 	}
 
-	for _, recipe := range recipes {
+	recipeList := make([]recipe, 0, len(merged))
+
+	for _, recipe := range merged {
 		recipeList = append(recipeList, recipe)
 	}
 
@@ -321,5 +647,34 @@ func (s *Spack) mergeRecipes(recipes map[string]recipe) {
 		return recipeList[i].Name < recipeList[j].Name
 	})
 
-	s.File.Encode(recipeList)
+	version.Encode(recipeList)
 }
+
+func (s *Spack) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case statusPath:
+		s.serveStatus(w, r)
+
+		return
+	case webhookPath:
+		s.serveWebhook(w, r)
+
+		return
+	}
+
+	version := r.URL.Query().Get("spack")
+	if version == "" {
+		version = s.defaultVersion
+	}
+
+	v, ok := s.versions[version]
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	v.ServeHTTP(w, r)
+}
+
+var ErrUnknownSourceVersion = errors.New("local source given for unconfigured spack version")
@@ -0,0 +1,76 @@
+package spack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const statusPath = "/status"
+
+type remoteStatus struct {
+	URL           string
+	Branch        string
+	Path          string
+	Commit        string
+	LastUpdate    time.Time
+	LastError     string
+	LastErrorTime time.Time
+}
+
+func (s *Spack) setRemoteUpdated(src *source, rr *remoteRepo) {
+	commit := headCommit(rr.repo)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	src.status.Commit = commit
+	src.status.LastUpdate = time.Now()
+}
+
+func (s *Spack) setRemoteError(src *source, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	src.status.LastError = err.Error()
+	src.status.LastErrorTime = time.Now()
+}
+
+func (s *Spack) remoteStatuses() []remoteStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]remoteStatus, len(s.remotes))
+
+	for n, src := range s.remotes {
+		redacted := redactURL(src.url)
+
+		statuses[n] = src.status
+		statuses[n].URL = redacted
+		statuses[n].LastError = strings.ReplaceAll(src.status.LastError, src.url, redacted)
+		statuses[n].Branch = src.branch
+		statuses[n].Path = src.path
+	}
+
+	return statuses
+}
+
+// redactURL removes any credentials from a remote URL so that it can be
+// reported without authentication.
+func redactURL(remote string) string {
+	u, err := url.Parse(remote)
+	if err != nil || u.User == nil {
+		return remote
+	}
+
+	u.User = nil
+
+	return u.String()
+}
+
+func (s *Spack) serveStatus(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.remoteStatuses()) //nolint:errcheck
+}
@@ -0,0 +1,160 @@
+package spack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	webhookPath    = "/webhook"
+	maxWebhookSize = 25 << 20
+
+	githubSignatureHeader = "X-Hub-Signature-256"
+	githubSignaturePrefix = "sha256="
+	gitlabTokenHeader     = "X-Gitlab-Token"
+)
+
+type webhookPayload struct {
+	Repository struct {
+		CloneURL string `json:"clone_url"`
+		SSHURL   string `json:"ssh_url"`
+		HTMLURL  string `json:"html_url"`
+	} `json:"repository"`
+	Project struct {
+		HTTPURL string `json:"git_http_url"`
+		SSHURL  string `json:"git_ssh_url"`
+		WebURL  string `json:"web_url"`
+	} `json:"project"`
+}
+
+func (w *webhookPayload) urls() []string {
+	var urls []string
+
+	for _, url := range [...]string{
+		w.Repository.CloneURL,
+		w.Repository.SSHURL,
+		w.Repository.HTMLURL,
+		w.Project.HTTPURL,
+		w.Project.SSHURL,
+		w.Project.WebURL,
+	} {
+		if url != "" {
+			urls = append(urls, normaliseURL(url))
+		}
+	}
+
+	return urls
+}
+
+// normaliseURL strips any credentials, trailing slash and .git suffix from a
+// repository URL, and lowercases its host, so that the URLs of a configured
+// remote and of a webhook payload can be compared.
+func normaliseURL(remote string) string {
+	if u, err := url.Parse(redactURL(remote)); err == nil && u.Host != "" {
+		u.Host = strings.ToLower(u.Host)
+		remote = u.String()
+	}
+
+	return strings.TrimSuffix(strings.TrimSuffix(remote, "/"), ".git")
+}
+
+func (s *Spack) serveWebhook(w http.ResponseWriter, r *http.Request) {
+	if len(s.webhookSecret) == 0 {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if !s.validWebhookSignature(r, body) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+		return
+	}
+
+	var payload webhookPayload
+
+	json.Unmarshal(body, &payload) //nolint:errcheck
+
+	urls := payload.urls()
+
+	debug("received recipe webhook", "urls", urls)
+
+	if !s.refreshRemotes(urls) {
+		debug("no remote matched recipe webhook", "urls", urls)
+
+		http.Error(w, ErrNoMatchingRemote.Error(), http.StatusNotFound)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Spack) validWebhookSignature(r *http.Request, body []byte) bool {
+	if token := r.Header.Get(gitlabTokenHeader); token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), s.webhookSecret) == 1
+	}
+
+	signature, err := hex.DecodeString(strings.TrimPrefix(r.Header.Get(githubSignatureHeader), githubSignaturePrefix))
+	if err != nil || len(signature) == 0 {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, s.webhookSecret)
+
+	mac.Write(body)
+
+	return hmac.Equal(signature, mac.Sum(nil))
+}
+
+// refreshRemotes triggers an update of the remotes matching any of the given
+// URLs, reporting whether any matched; hooks for unknown repositories are
+// ignored.
+func (s *Spack) refreshRemotes(urls []string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []*source
+
+	for _, src := range s.remotes {
+		for _, u := range urls {
+			if normaliseURL(src.url) == u {
+				matched = append(matched, src)
+
+				break
+			}
+		}
+	}
+
+	for _, src := range matched {
+		select {
+		case src.refresh <- struct{}{}:
+		default:
+		}
+	}
+
+	return len(matched) > 0
+}
+
+var ErrNoMatchingRemote = errors.New("no matching remote")